@@ -0,0 +1,58 @@
+// Command backfill-versions computes the <predicate>_numeric and
+// <predicate>_prerelease companions of the version predicates that version
+// filters compare. Rerun it after importing data so that new and changed
+// versions are picked up.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/shahariaz/user_segmentation/dgraph"
+	"github.com/shahariaz/user_segmentation/internal/backfill"
+	"github.com/shahariaz/user_segmentation/internal/config"
+)
+
+func main() {
+	dgraphConfig := dgraph.DefaultConfig()
+
+	flag.StringVar(&dgraphConfig.Host, "host", dgraphConfig.Host, "Dgraph alpha host")
+	flag.StringVar(&dgraphConfig.Port, "port", dgraphConfig.Port, "Dgraph alpha gRPC port")
+	batchSize := flag.Int("batch-size", backfill.DefaultBatchSize, "nodes read and written per batch")
+	dryRun := flag.Bool("dry-run", false, "report changes without writing them")
+	flag.Parse()
+
+	client, err := dgraph.NewClient(dgraphConfig)
+	if err != nil {
+		log.Fatalf("❌ Could not connect to Dgraph: %v", err)
+	}
+	defer client.Close()
+
+	opts := backfill.VersionOptions{BatchSize: *batchSize, DryRun: *dryRun}
+	failed := false
+
+	for _, predicate := range config.GetVersionPredicates() {
+		report, err := backfill.BackfillVersions(context.Background(), client, predicate, opts)
+		if err != nil {
+			log.Printf("❌ %s: %v", predicate, err)
+			failed = true
+			continue
+		}
+
+		fmt.Printf("%s: scanned %d, updated %d, unchanged %d, cleared %d, unparseable %d\n",
+			report.Predicate, report.Scanned, report.Updated, report.Unchanged, report.Cleared, len(report.Failures))
+		for _, failure := range report.Failures {
+			fmt.Printf("  %s %q: %s\n", failure.UID, failure.Version, failure.Error)
+		}
+	}
+
+	if *dryRun {
+		fmt.Println("Dry run, nothing was written")
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
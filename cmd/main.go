@@ -21,6 +21,8 @@ func main() {
 
 		api.POST("/query", queryHandler.HandleQuery)
 		api.POST("/execute", queryHandler.ExecuteQuery)
+		api.POST("/count", queryHandler.CountQuery)
+		api.POST("/explain", queryHandler.ExplainQuery)
 	}
 
 	log.Fatal(router.Run(":8010"))
@@ -109,6 +109,12 @@ func (c *Client) TestConnection() error {
 
 // ExecuteDQL executes a DQL query and returns the results
 func (c *Client) ExecuteDQL(ctx context.Context, query string) (*QueryResponse, error) {
+	return c.ExecuteDQLWithVars(ctx, query, nil)
+}
+
+// ExecuteDQLWithVars executes a DQL query declaring GraphQL-style variables
+// such as $v0 with the given values and returns the results
+func (c *Client) ExecuteDQLWithVars(ctx context.Context, query string, vars map[string]string) (*QueryResponse, error) {
 	start := time.Now()
 
 	// Set timeout if not already set in context
@@ -123,7 +129,11 @@ func (c *Client) ExecuteDQL(ctx context.Context, query string) (*QueryResponse,
 	var err error
 
 	for attempt := 0; attempt <= c.config.MaxRetries; attempt++ {
-		response, err = c.dgraphClient.NewTxn().Query(ctx, query)
+		if len(vars) > 0 {
+			response, err = c.dgraphClient.NewReadOnlyTxn().QueryWithVars(ctx, query, vars)
+		} else {
+			response, err = c.dgraphClient.NewTxn().Query(ctx, query)
+		}
 		if err == nil {
 			break
 		}
@@ -166,6 +176,28 @@ func (c *Client) ExecuteDQL(ctx context.Context, query string) (*QueryResponse,
 	}, nil
 }
 
+// Mutate applies JSON set and delete mutations in a single committed
+// transaction. Either may be nil.
+func (c *Client) Mutate(ctx context.Context, setJSON, deleteJSON []byte) error {
+	if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.RequestTimeout)
+		defer cancel()
+	}
+
+	mutation := &api.Mutation{
+		SetJson:    setJSON,
+		DeleteJson: deleteJSON,
+		CommitNow:  true,
+	}
+
+	if _, err := c.dgraphClient.NewTxn().Mutate(ctx, mutation); err != nil {
+		return fmt.Errorf("mutation failed: %w", err)
+	}
+
+	return nil
+}
+
 // ExecuteMultipleDQL executes multiple DQL queries and returns combined results
 func (c *Client) ExecuteMultipleDQL(ctx context.Context, queries []string) (map[string]*QueryResponse, error) {
 	results := make(map[string]*QueryResponse)
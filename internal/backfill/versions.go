@@ -0,0 +1,176 @@
+// Package backfill computes derived predicates that the converter relies on
+// but that the systems writing to Dgraph do not maintain.
+package backfill
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/shahariaz/user_segmentation/dgraph"
+	"github.com/shahariaz/user_segmentation/internal/utils"
+)
+
+// DefaultBatchSize is the number of nodes read and written per round trip
+const DefaultBatchSize = 1000
+
+// VersionOptions configures a version backfill
+type VersionOptions struct {
+	BatchSize int
+	// DryRun computes and reports changes without writing them
+	DryRun bool
+}
+
+// VersionReport summarizes the backfill of one version predicate
+type VersionReport struct {
+	Predicate string           `json:"predicate"`
+	Scanned   int              `json:"scanned"`
+	Updated   int              `json:"updated"`
+	Unchanged int              `json:"unchanged"`
+	Cleared   int              `json:"cleared"`
+	Failures  []VersionFailure `json:"failures,omitempty"`
+}
+
+// VersionFailure is a node whose version could not be converted. Any numeric
+// value left from an earlier run is cleared so it cannot match stale filters.
+type VersionFailure struct {
+	UID     string `json:"uid"`
+	Version string `json:"version"`
+	Error   string `json:"error"`
+}
+
+// versionRow is a node with its version and current derived values
+type versionRow struct {
+	UID        string `json:"uid"`
+	Version    string `json:"version"`
+	Numeric    *int64 `json:"numeric"`
+	Prerelease *bool  `json:"prerelease"`
+}
+
+// BackfillVersions sets <predicate>_numeric on every node that has the
+// version predicate, and <predicate>_prerelease to true on pre-releases. Only
+// values that are missing or out of date are written, so it can be rerun to
+// pick up versions written since the last run.
+func BackfillVersions(ctx context.Context, client *dgraph.Client, predicate string, opts VersionOptions) (*VersionReport, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+
+	report := &VersionReport{Predicate: predicate}
+	numericPredicate := predicate + "_numeric"
+	prereleasePredicate := predicate + "_prerelease"
+	after := "0x0"
+
+	for {
+		rows, err := fetchVersionPage(ctx, client, predicate, after, opts.BatchSize)
+		if err != nil {
+			return report, err
+		}
+		if len(rows) == 0 {
+			return report, nil
+		}
+
+		var updates, clears []map[string]interface{}
+		for _, row := range rows {
+			report.Scanned++
+
+			version, err := utils.ParseVersion(row.Version)
+			var numeric int64
+			if err == nil {
+				numeric, err = version.Numeric()
+			}
+			if err != nil {
+				report.Failures = append(report.Failures, VersionFailure{UID: row.UID, Version: row.Version, Error: err.Error()})
+				if row.Numeric != nil || row.Prerelease != nil {
+					clears = append(clears, map[string]interface{}{"uid": row.UID, numericPredicate: nil, prereleasePredicate: nil})
+				}
+				continue
+			}
+
+			// Releases carry no flag rather than false
+			prerelease := len(version.Prerelease) > 0
+			if row.Numeric != nil && *row.Numeric == numeric && (row.Prerelease != nil) == prerelease {
+				report.Unchanged++
+				continue
+			}
+
+			update := map[string]interface{}{"uid": row.UID, numericPredicate: numeric}
+			if prerelease {
+				update[prereleasePredicate] = true
+			} else if row.Prerelease != nil {
+				clears = append(clears, map[string]interface{}{"uid": row.UID, prereleasePredicate: nil})
+			}
+			updates = append(updates, update)
+		}
+
+		if err := writeVersionBatch(ctx, client, updates, clears, opts.DryRun); err != nil {
+			return report, fmt.Errorf("writing %s after %s: %w", numericPredicate, after, err)
+		}
+		report.Updated += len(updates)
+		report.Cleared += len(clears)
+
+		log.Printf("%s: scanned %d, updated %d, failed %d", predicate, report.Scanned, report.Updated, len(report.Failures))
+
+		after = rows[len(rows)-1].UID
+		if len(rows) < opts.BatchSize {
+			return report, nil
+		}
+	}
+}
+
+// fetchVersionPage reads the next page of nodes with the version predicate in
+// uid order
+func fetchVersionPage(ctx context.Context, client *dgraph.Client, predicate, after string, batchSize int) ([]versionRow, error) {
+	// after is a uid returned by Dgraph and predicate comes from the schema
+	// configuration, so both are safe to interpolate
+	query := fmt.Sprintf(`{
+  rows(func: has(%s), first: %d, after: %s) {
+    uid
+    version: %s
+    numeric: %s_numeric
+    prerelease: %s_prerelease
+  }
+}`, predicate, batchSize, after, predicate, predicate, predicate)
+
+	response, err := client.ExecuteDQL(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s after %s: %w", predicate, after, err)
+	}
+
+	// Round-trip through JSON to decode the generic response into rows
+	data, err := json.Marshal(response.Data)
+	if err != nil {
+		return nil, err
+	}
+	var page struct {
+		Rows []versionRow `json:"rows"`
+	}
+	if err := json.Unmarshal(data, &page); err != nil {
+		return nil, fmt.Errorf("decoding %s page: %w", predicate, err)
+	}
+
+	return page.Rows, nil
+}
+
+// writeVersionBatch sets new derived values and deletes stale ones
+func writeVersionBatch(ctx context.Context, client *dgraph.Client, updates, clears []map[string]interface{}, dryRun bool) error {
+	if dryRun || (len(updates) == 0 && len(clears) == 0) {
+		return nil
+	}
+
+	var setJSON, deleteJSON []byte
+	var err error
+	if len(updates) > 0 {
+		if setJSON, err = json.Marshal(updates); err != nil {
+			return err
+		}
+	}
+	if len(clears) > 0 {
+		if deleteJSON, err = json.Marshal(clears); err != nil {
+			return err
+		}
+	}
+
+	return client.Mutate(ctx, setJSON, deleteJSON)
+}
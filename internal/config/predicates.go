@@ -0,0 +1,86 @@
+package config
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/shahariaz/user_segmentation/internal/hizibizi"
+	models "github.com/shahariaz/user_segmentation/internal/model"
+)
+
+// predicateLinePattern matches a predicate definition such as
+// "customers.country: string @index(exact, hash) ."
+var predicateLinePattern = regexp.MustCompile(`^([\w.~]+)\s*:\s*(\[?\w+\]?)\s*(.*?)\s*\.$`)
+
+var indexDirectivePattern = regexp.MustCompile(`@index\(([^)]*)\)`)
+
+// GetPredicateSchema returns the predicate definitions of the bundled Dgraph schema
+func GetPredicateSchema() map[string]models.PredicateSchema {
+	return ParseDgraphSchema(hizibizi.Schema)
+}
+
+// ParseDgraphSchema extracts predicate types, indexes and directives from a
+// DQL schema. Type definitions and unknown lines are ignored.
+func ParseDgraphSchema(schema string) map[string]models.PredicateSchema {
+	predicates := make(map[string]models.PredicateSchema)
+
+	for _, line := range strings.Split(schema, "\n") {
+		match := predicateLinePattern.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+
+		predicate := models.PredicateSchema{
+			Name:    match[1],
+			Type:    strings.Trim(match[2], "[]"),
+			List:    strings.HasPrefix(match[2], "["),
+			Reverse: strings.Contains(match[3], "@reverse"),
+		}
+
+		if index := indexDirectivePattern.FindStringSubmatch(match[3]); index != nil {
+			for _, tokenizer := range strings.Split(index[1], ",") {
+				if tokenizer = strings.TrimSpace(tokenizer); tokenizer != "" {
+					predicate.Indexes = append(predicate.Indexes, tokenizer)
+				}
+			}
+		}
+
+		predicates[predicate.Name] = predicate
+	}
+
+	return predicates
+}
+
+// introspectedPredicate is a predicate as listed by a DQL schema {} query
+type introspectedPredicate struct {
+	Predicate string   `json:"predicate"`
+	Type      string   `json:"type"`
+	Tokenizer []string `json:"tokenizer"`
+	List      bool     `json:"list"`
+	Reverse   bool     `json:"reverse"`
+}
+
+// ParseSchemaIntrospection extracts predicate types, indexes and directives
+// from the JSON response of a DQL schema {} query run against Dgraph
+func ParseSchemaIntrospection(data []byte) (map[string]models.PredicateSchema, error) {
+	var response struct {
+		Schema []introspectedPredicate `json:"schema"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+
+	predicates := make(map[string]models.PredicateSchema, len(response.Schema))
+	for _, introspected := range response.Schema {
+		predicates[introspected.Predicate] = models.PredicateSchema{
+			Name:    introspected.Predicate,
+			Type:    introspected.Type,
+			List:    introspected.List,
+			Indexes: introspected.Tokenizer,
+			Reverse: introspected.Reverse,
+		}
+	}
+
+	return predicates, nil
+}
@@ -1,6 +1,10 @@
 package config
 
-import models "github.com/shahariaz/user_segmentation/internal/model"
+import (
+	"slices"
+
+	models "github.com/shahariaz/user_segmentation/internal/model"
+)
 
 // GetSchemaConfig returns the predefined schema configuration for the platform
 func GetSchemaConfig() *models.SchemaInfo {
@@ -16,7 +20,8 @@ func getFieldMappings() map[string][]models.FieldMapping {
 	return map[string][]models.FieldMapping{
 		// Customer fields
 		"age": {
-			{JSONField: "age", DgraphField: "customers.age", EntityType: "customers", DataType: "int"},
+			{JSONField: "age", DgraphField: "customers.date_of_birth", EntityType: "customers", DataType: "int",
+				Computed: &models.ComputedField{Unit: "years", Direction: "since"}},
 		},
 		"country": {
 			{JSONField: "country", DgraphField: "customers.country", EntityType: "customers", DataType: "string"},
@@ -78,6 +83,12 @@ func getFieldMappings() map[string][]models.FieldMapping {
 		"watched_content": {
 			{JSONField: "watched_content", DgraphField: "watch_histories.content_id", EntityType: "watch_histories", DataType: "complex"},
 		},
+		"watch_duration": {
+			{JSONField: "watch_duration", DgraphField: "watch_histories.watch_duration", EntityType: "watch_histories", DataType: "int"},
+		},
+		"completion_rate": {
+			{JSONField: "completion_rate", DgraphField: "watch_histories.completion_rate", EntityType: "watch_histories", DataType: "float"},
+		},
 		"favorite_genres": {
 			{JSONField: "favorite_genres", DgraphField: "watch_histories.genre", EntityType: "watch_histories", DataType: "array"},
 		},
@@ -109,6 +120,9 @@ func getFieldMappings() map[string][]models.FieldMapping {
 		"purchase_status": {
 			{JSONField: "purchase_status", DgraphField: "purchases.status", EntityType: "purchases", DataType: "string"},
 		},
+		"purchase_amount": {
+			{JSONField: "purchase_amount", DgraphField: "purchases.amount", EntityType: "purchases", DataType: "float"},
+		},
 
 		// Datetime fields for customers
 		"created_at": {
@@ -123,6 +137,19 @@ func getFieldMappings() map[string][]models.FieldMapping {
 		"registration_date": {
 			{JSONField: "registration_date", DgraphField: "customers.created_at", EntityType: "customers", DataType: "datetime"},
 		},
+		"date_of_birth": {
+			{JSONField: "date_of_birth", DgraphField: "customers.date_of_birth", EntityType: "customers", DataType: "datetime"},
+		},
+
+		// Computed fields, evaluated against the current time at conversion
+		"days_since_last_login": {
+			{JSONField: "days_since_last_login", DgraphField: "customers.last_login_date", EntityType: "customers", DataType: "int",
+				Computed: &models.ComputedField{Unit: "days", Direction: "since"}},
+		},
+		"subscription_days_left": {
+			{JSONField: "subscription_days_left", DgraphField: "subscriptions.end_date", EntityType: "subscriptions", DataType: "int",
+				Computed: &models.ComputedField{Unit: "days", Direction: "until"}},
+		},
 
 		// Datetime fields for subscriptions
 		"subscription_start_date": {
@@ -211,6 +238,7 @@ func getDefaultFields() map[string][]string {
 			"customers.name",
 			"customers.email",
 			"customers.age",
+			"customers.date_of_birth",
 			"customers.country",
 			"customers.city",
 			"customers.device",
@@ -274,8 +302,8 @@ func GetOperatorMappings() map[string]string {
 		"IN":          "eq",
 		"NOT_IN":      "not",
 		"!=":          "not",
-		"LIKE":        "alloftext",
-		"ILIKE":       "anyoftext",
+		"LIKE":        "regexp",
+		"ILIKE":       "regexp",
 		"REGEX":       "regexp",
 		"BETWEEN":     "between",
 		"IS_NULL":     "eq",
@@ -283,17 +311,53 @@ func GetOperatorMappings() map[string]string {
 		"STARTS_WITH": "alloftext",
 		"ENDS_WITH":   "alloftext",
 		"CONTAINS":    "alloftext",
+
+		// List operators for [string] predicates
+		"CONTAINS_ANY":  "eq",
+		"CONTAINS_ALL":  "eq",
+		"CONTAINS_NONE": "eq",
+
+		// Version operators for fields listed in GetVersionFields
+		"VERSION_RANGE": "between",
+
+		// Relationship operators, taking a relationship instead of a field
+		"HAS_NONE": "has",
 	}
 }
 
+// GetVersionFields returns the fields holding semantic versions and how they
+// are compared. Each must have a field mapping.
 func GetVersionFields() map[string]string {
 	return map[string]string{
 		"app_version": "numeric",
 		"os_version":  "numeric",
-		"version":     "numeric",
 	}
 }
 
+// GetVersionPredicates returns the string predicates of the numeric version
+// fields. Each has a <predicate>_numeric companion holding
+// utils.ConvertVersionToNumeric of its value, which version filters compare,
+// and a <predicate>_prerelease companion set to true on pre-releases, which
+// version ranges exclude.
+func GetVersionPredicates() []string {
+	var predicates []string
+	mappings := getFieldMappings()
+
+	for field, mode := range GetVersionFields() {
+		if mode != "numeric" {
+			continue
+		}
+		for _, mapping := range mappings[field] {
+			if !slices.Contains(predicates, mapping.DgraphField) {
+				predicates = append(predicates, mapping.DgraphField)
+			}
+		}
+	}
+
+	slices.Sort(predicates)
+	return predicates
+}
+
 func GetReversePredicates() map[string]string {
 	return map[string]string{
 		"subscriptions":   "~customers.subscriptions",
@@ -304,16 +368,45 @@ func GetReversePredicates() map[string]string {
 	}
 }
 
-// GetFilterOptimizations returns common filter optimization patterns
-func GetFilterOptimizations() map[string][]string {
-	return map[string][]string{
+// GetFilterOptimizations returns the filter macros that queries reference by
+// name, such as {"macro": "premium_subscriber"}
+func GetFilterOptimizations() map[string]models.FilterMacro {
+	return map[string]models.FilterMacro{
+		"subscriber": {
+			Description: "has a subscription to the package in one of the statuses",
+			Params: map[string]interface{}{
+				"package":  nil,
+				"statuses": []interface{}{"active"},
+			},
+			Group: models.Group{
+				CombineWith: "AND",
+				Scope:       "subscriptions",
+				Filters: []models.Filter{
+					{Field: "subscribed_package", Op: "=", Value: map[string]interface{}{"param": "package"}},
+					{Field: "subscription_status", Op: "IN", Value: map[string]interface{}{"param": "statuses"}},
+				},
+			},
+		},
 		"subscription_status_premium": {
-			"eq(subscriptions.package, \"Premium\")",
-			"(eq(subscriptions.status, \"active\") OR eq(subscriptions.status, \"trial\"))",
+			Description: "has an active or trial Premium subscription",
+			Group: models.Group{
+				Macro: "subscriber",
+				Args: map[string]interface{}{
+					"package":  "Premium",
+					"statuses": []interface{}{"active", "trial"},
+				},
+			},
 		},
 		"subscription_status_basic": {
-			"eq(subscriptions.package, \"Basic\")",
-			"eq(subscriptions.status, \"active\")",
+			Description: "has an active Basic subscription",
+			Group: models.Group{
+				Macro: "subscriber",
+				Args:  map[string]interface{}{"package": "Basic"},
+			},
+		},
+		"premium_subscriber": {
+			Description: "has an active or trial Premium subscription",
+			Group:       models.Group{Macro: "subscription_status_premium"},
 		},
 	}
 }
@@ -326,3 +419,36 @@ func GetPaginationConfig() map[string]int {
 		"default_offset": 0,
 	}
 }
+
+// GetComplexityBudget returns the default query complexity budget
+func GetComplexityBudget() models.ComplexityBudget {
+	return models.ComplexityBudget{
+		MaxLimit:      GetPaginationConfig()["max_limit"],
+		MaxGroupDepth: 5,
+		MaxFilters:    50,
+		MaxInValues:   500,
+		MaxVarBlocks:  25,
+
+		MaxRelationDepth: 3,
+	}
+}
+
+// GetAPIClients returns the API clients that need more than the default
+// complexity budget, keyed by client name. A client without an API key in
+// its environment variable is disabled.
+func GetAPIClients() map[string]models.APIClient {
+	return map[string]models.APIClient{
+		"segment-export": {
+			KeyEnv: "SEGMENT_EXPORT_API_KEY",
+			Budget: models.ComplexityBudget{
+				MaxLimit:      10000,
+				MaxGroupDepth: 5,
+				MaxFilters:    50,
+				MaxInValues:   5000,
+				MaxVarBlocks:  25,
+
+				MaxRelationDepth: 3,
+			},
+		},
+	}
+}
@@ -0,0 +1,66 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+
+	models "github.com/shahariaz/user_segmentation/internal/model"
+)
+
+// processHasNoneFilter compiles a HAS_NONE filter, keeping roots without any
+// record of the relationship matching the optional where group. A direct edge
+// without conditions compiles to NOT has(edge); anything else collects the
+// roots that do have a matching record and excludes them with NOT uid(var).
+func (c *Converter) processHasNoneFilter(filter models.Filter, mainEntityType string, varCounter int, path string, report *ValidationError, params *queryParams) (Expr, []VarBlock, int) {
+	if filter.Field != "" {
+		report.add(path+".field", CodeInvalidValue,
+			"HAS_NONE takes a relationship instead of a field",
+			fmt.Sprintf(`use "relationship" with a where group on field %q`, filter.Field))
+		return nil, nil, varCounter
+	}
+
+	if !c.isEntityType(filter.Relationship) {
+		report.add(path+".relationship", CodeUnknownEntity,
+			fmt.Sprintf("unknown entity type %q", filter.Relationship),
+			"use one of: "+strings.Join(c.schema.EntityTypes, ", "))
+		return nil, nil, varCounter
+	}
+
+	predicates := c.relationshipPath(mainEntityType, filter.Relationship)
+	if predicates == nil {
+		report.add(path+".relationship", CodeUnreachableEntity,
+			fmt.Sprintf("entity %q cannot be reached from %q", filter.Relationship, mainEntityType),
+			fmt.Sprintf("use an entity related to %s", mainEntityType))
+		return nil, nil, varCounter
+	}
+
+	var condition Expr
+	if filter.Where != nil {
+		condition = c.buildScopedCondition(*filter.Where, filter.Relationship, path+".where", report, params)
+		if condition == nil {
+			return nil, nil, varCounter
+		}
+	}
+
+	// has() only accepts forward predicates
+	if condition == nil && len(predicates) == 1 && !strings.HasPrefix(predicates[0], "~") {
+		return newNot(newComparison("has", predicates[0])), nil, varCounter
+	}
+
+	return c.buildHasNoneBlock(predicates, condition, mainEntityType, varCounter)
+}
+
+// buildHasNoneBlock collects the roots reaching a related record matching the
+// condition into a var block and excludes them
+func (c *Converter) buildHasNoneBlock(predicates []string, condition Expr, mainEntityType string, varCounter int) (Expr, []VarBlock, int) {
+	varName := fmt.Sprintf("var%d", varCounter)
+	varCounter++
+
+	variable := VarBlock{
+		Name:      varName,
+		Type:      mainEntityType,
+		Traversal: &Traversal{Edges: predicates, Filter: condition},
+	}
+
+	return newNot(&VarRef{Name: varName}), []VarBlock{variable}, varCounter
+}
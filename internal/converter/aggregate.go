@@ -0,0 +1,171 @@
+package converter
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	models "github.com/shahariaz/user_segmentation/internal/model"
+)
+
+// aggregateFunctions lists the supported aggregates and the data types they accept
+var aggregateFunctions = map[string][]string{
+	"count": nil,
+	"sum":   {"int", "float"},
+	"avg":   {"int", "float"},
+	"min":   {"int", "float", "datetime"},
+	"max":   {"int", "float", "datetime"},
+}
+
+// aggregateSpec names an aggregate over the related records of the root entity
+type aggregateSpec struct {
+	aggregate    string
+	relationship string
+	field        string
+	where        *models.Group
+}
+
+// processAggregateFilter compiles a count or sum/avg/min/max filter over a
+// relationship of the root entity. The aggregate is computed into a value
+// variable by an unnamed var block and compared with val() in the main filter.
+func (c *Converter) processAggregateFilter(filter models.Filter, mainEntityType string, varCounter int, path string, report *ValidationError, params *queryParams) (Expr, []VarBlock, int) {
+	var variables []VarBlock
+
+	spec := aggregateSpec{
+		aggregate:    filter.Aggregate,
+		relationship: filter.Relationship,
+		field:        filter.Field,
+		where:        filter.Where,
+	}
+
+	aggregateVar, valueType, block, varCounter := c.buildAggregateBlock(spec, mainEntityType, varCounter, path, report, params)
+	if block == nil {
+		return nil, variables, varCounter
+	}
+
+	comparison := c.buildAggregateComparison(filter, aggregateVar, valueType, path, report, params)
+	if comparison == nil {
+		return nil, variables, varCounter
+	}
+
+	variables = append(variables, *block)
+	return comparison, variables, varCounter
+}
+
+// buildAggregateBlock builds the unnamed var block computing an aggregate into
+// a value variable. It returns the variable name, the data type of its values
+// and the block, which is nil when the aggregate is invalid.
+func (c *Converter) buildAggregateBlock(spec aggregateSpec, mainEntityType string, varCounter int, path string, report *ValidationError, params *queryParams) (string, string, *VarBlock, int) {
+	aggregate := strings.ToLower(spec.aggregate)
+	dataTypes, supported := aggregateFunctions[aggregate]
+	if !supported {
+		report.add(path+".aggregate", CodeInvalidValue,
+			fmt.Sprintf("unknown aggregate %q", spec.aggregate),
+			`use "count", "sum", "avg", "min" or "max"`)
+		return "", "", nil, varCounter
+	}
+
+	edge := c.edgePredicate(mainEntityType, spec.relationship)
+	if edge == "" {
+		report.add(path+".relationship", CodeUnreachableEntity,
+			fmt.Sprintf("%q is not a relationship of %q", spec.relationship, mainEntityType),
+			"use one of: "+strings.Join(c.schema.Relationships[mainEntityType], ", "))
+		return "", "", nil, varCounter
+	}
+
+	var mapping *models.FieldMapping
+	valueType := "int"
+	if aggregate != "count" {
+		mapping = c.relationshipFieldMapping(spec.field, spec.relationship)
+		if mapping == nil {
+			report.add(path+".field", CodeUnknownField,
+				fmt.Sprintf("field %q is not a field of %q", spec.field, spec.relationship),
+				fmt.Sprintf("%s requires a field of the related entity", aggregate))
+			return "", "", nil, varCounter
+		}
+		if !slices.Contains(dataTypes, mapping.DataType) || mapping.Computed != nil {
+			report.add(path+".field", CodeUnsupportedOperand,
+				fmt.Sprintf("%s cannot be applied to %s field %q", aggregate, aggregateFieldKind(mapping), spec.field),
+				"aggregate a numeric field")
+			return "", "", nil, varCounter
+		}
+		valueType = mapping.DataType
+		if aggregate == "sum" || aggregate == "avg" {
+			valueType = "float"
+		}
+	}
+
+	var edgeFilter Expr
+	if spec.where != nil {
+		edgeFilter = c.buildScopedCondition(*spec.where, spec.relationship, path+".where", report, params)
+	}
+
+	aggregateVar := fmt.Sprintf("var%d", varCounter)
+	varCounter++
+
+	node := &Aggregate{Var: aggregateVar, Func: aggregate, Edge: edge, Filter: edgeFilter}
+	if aggregate != "count" {
+		node.Predicate = mapping.DgraphField
+		node.ValueVar = fmt.Sprintf("var%d", varCounter)
+		varCounter++
+	}
+
+	block := &VarBlock{
+		Type:      mainEntityType,
+		Aggregate: node,
+	}
+
+	return aggregateVar, valueType, block, varCounter
+}
+
+// buildAggregateComparison compares a value variable with the filter value
+func (c *Converter) buildAggregateComparison(filter models.Filter, valueVar, valueType, path string, report *ValidationError, params *queryParams) Expr {
+	compare := func(function, value string) *Comparison {
+		return &Comparison{Func: function, ValueVar: valueVar, Args: []string{value}}
+	}
+
+	switch filter.Op {
+	case "=", ">=", "<=", ">", "<", "!=":
+		if !c.validateValue(filter, valueType, path+".value", report) {
+			return nil
+		}
+		value := c.bindValue(params, filter.Value, valueType)
+		if filter.Op == "!=" {
+			return newNot(compare("eq", value))
+		}
+		return compare(c.operators[filter.Op], value)
+
+	case "BETWEEN":
+		if !c.validateValue(filter, valueType, path+".value", report) {
+			return nil
+		}
+		low, high, _ := betweenOperands(filter.Value)
+		min := c.bindValue(params, low, valueType)
+		max := c.bindValue(params, high, valueType)
+		return newAnd(compare("ge", min), compare("le", max))
+
+	default:
+		report.add(path+".op", CodeUnknownOperator,
+			fmt.Sprintf("operator %q cannot be used with an aggregate", filter.Op),
+			"use =, !=, >, >=, <, <= or BETWEEN")
+		return nil
+	}
+}
+
+// aggregateFieldKind describes a field in aggregate errors
+func aggregateFieldKind(mapping *models.FieldMapping) string {
+	if mapping.Computed != nil {
+		return "computed"
+	}
+	return mapping.DataType
+}
+
+// relationshipFieldMapping returns the mapping of a JSON field on the given entity
+func (c *Converter) relationshipFieldMapping(field, entityType string) *models.FieldMapping {
+	for _, mapping := range c.schema.FieldMappings[field] {
+		if mapping.EntityType == entityType {
+			return &mapping
+		}
+	}
+	return nil
+}
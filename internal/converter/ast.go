@@ -0,0 +1,156 @@
+package converter
+
+import models "github.com/shahariaz/user_segmentation/internal/model"
+
+// A JSONQuery is compiled into a Query tree before being printed as DQL, so
+// that rewrites and checks can work on the structure of a query rather than
+// on its text. Filter values are bound as query variables while the tree is
+// built, so nodes carry variable names such as $v0 and never raw values.
+
+// Expr is a node of a filter condition
+type Expr interface {
+	exprNode()
+}
+
+// Comparison applies a DQL function to a predicate or to a value variable,
+// such as eq(customers.country, $v0) or ge(val(var1), $v2). eq with several
+// Args matches any of them and prints as eq(customers.country, [$v0, $v1]).
+type Comparison struct {
+	Func      string   // eq, ge, le, gt, lt, has, regexp, alloftext, type, ...
+	Predicate string   // the compared predicate, empty when ValueVar is set
+	ValueVar  string   // compares val(ValueVar) instead of a predicate
+	Args      []string // query variables such as $v0 or literals such as regex patterns
+}
+
+// BoolOp combines its operands with AND or OR
+type BoolOp struct {
+	Op       string // "AND" or "OR"
+	Operands []Expr
+}
+
+// Not negates its operand
+type Not struct {
+	Operand Expr
+}
+
+// VarRef matches the nodes collected by a named var block, uid(Name)
+type VarRef struct {
+	Name string
+}
+
+func (*Comparison) exprNode() {}
+func (*BoolOp) exprNode()     {}
+func (*Not) exprNode()        {}
+func (*VarRef) exprNode()     {}
+
+// Traversal is a relationship scope. It holds for root nodes reaching, along
+// Edges, a related node that matches Filter, or any related node when Filter
+// is nil.
+type Traversal struct {
+	Edges  []string
+	Filter Expr
+}
+
+// Aggregate computes count, sum, avg, min or max over the nodes related to the
+// root through Edge into the value variable Var
+type Aggregate struct {
+	Var       string
+	Func      string
+	Edge      string
+	Filter    Expr   // per-record conditions on the related nodes
+	Predicate string // aggregated predicate, empty for count
+	ValueVar  string // collects the Predicate values aggregated into Var
+}
+
+// VarBlock is a var block over the nodes of Type. A named block collects the
+// roots matching Traversal; an unnamed one computes Aggregate.
+type VarBlock struct {
+	Name      string
+	Type      string
+	Traversal *Traversal
+	Aggregate *Aggregate
+}
+
+// Selection is what a block returns for each node: predicates and blocks of
+// related nodes, or only the number of nodes when Count is set
+type Selection struct {
+	Fields    []string // uid and predicates
+	ExpandAll bool     // adds expand(_all_) for types without default fields
+	Edges     []EdgeSelection
+	Count     bool // returns count(uid) instead of fields and edges
+}
+
+// EdgeSelection returns the nodes reached through Edge that match Filter, or
+// all of them when Filter is nil, ordered and limited independently of the
+// enclosing block
+type EdgeSelection struct {
+	Edge      string
+	Filter    Expr
+	Order     []OrderKey
+	First     int // 0 returns every node
+	Selection Selection
+}
+
+// OrderKey sorts by a predicate or by the value variable ValueVar
+type OrderKey struct {
+	Predicate string
+	ValueVar  string
+	Desc      bool
+}
+
+// Page is the slice of results a query returns: First nodes from Offset, or
+// after the node with uid After when it is set
+type Page struct {
+	First  int
+	Offset int
+	After  string
+}
+
+// Query is the tree of a converted JSONQuery
+type Query struct {
+	Vars   []VarBlock
+	Name   string
+	Type   string
+	Root   Expr // root function, type(Type) unless a rewrite picks another
+	Filter Expr // nil when the query has no filter
+
+	Selection Selection
+	Order     []OrderKey
+	Page      *Page // nil returns every result
+
+	Params   []models.QueryParam
+	Warnings []models.QueryWarning
+}
+
+// newComparison returns a comparison of a predicate
+func newComparison(function, predicate string, args ...string) *Comparison {
+	return &Comparison{Func: function, Predicate: predicate, Args: args}
+}
+
+// newAnd and newOr combine operands, returning a lone operand unchanged and
+// nil when there are none
+func newAnd(operands ...Expr) Expr {
+	return newBoolOp("AND", operands)
+}
+
+func newOr(operands ...Expr) Expr {
+	return newBoolOp("OR", operands)
+}
+
+func newBoolOp(op string, operands []Expr) Expr {
+	switch len(operands) {
+	case 0:
+		return nil
+	case 1:
+		return operands[0]
+	}
+	return &BoolOp{Op: op, Operands: operands}
+}
+
+// newNot negates an expression, removing a double negation
+func newNot(operand Expr) Expr {
+	if not, ok := operand.(*Not); ok {
+		return not.Operand
+	}
+	return &Not{Operand: operand}
+}
@@ -0,0 +1,134 @@
+package converter
+
+import (
+	"fmt"
+
+	models "github.com/shahariaz/user_segmentation/internal/model"
+)
+
+// CodeBudgetExceeded is reported when a query exceeds the complexity budget
+const CodeBudgetExceeded = "budget_exceeded"
+
+// WithBudget sets the complexity budget enforced by ConvertToDQL
+func WithBudget(budget models.ComplexityBudget) Option {
+	return func(c *Converter) {
+		c.budget = budget
+	}
+}
+
+// checkBudget reports group and relation nesting, filter counts and IN-list
+// sizes that exceed the complexity budget. Filters of selected relations and of sort
+// aggregates count along with those of the groups.
+func (c *Converter) checkBudget(jsonQuery *models.JSONQuery, report *ValidationError) {
+	filters := 0
+	for i, group := range jsonQuery.Groups {
+		filters += c.checkGroupBudget(group, fmt.Sprintf("groups[%d]", i), 1, report)
+	}
+	for i, key := range jsonQuery.Sort {
+		if key.Where != nil {
+			filters += c.checkGroupBudget(*key.Where, fmt.Sprintf("sort[%d].where", i), 1, report)
+		}
+	}
+	if jsonQuery.Select != nil {
+		filters += c.checkRelationsBudget(jsonQuery.Select.Relations, "select", 1, report)
+	}
+
+	if filters > c.budget.MaxFilters {
+		report.add("groups", CodeBudgetExceeded,
+			fmt.Sprintf("query has %d filters, the limit is %d", filters, c.budget.MaxFilters),
+			"split the segment or use IN instead of many = filters")
+	}
+}
+
+// checkGroupBudget checks a group at the given nesting depth and returns the
+// number of filters it contains
+func (c *Converter) checkGroupBudget(group models.Group, path string, depth int, report *ValidationError) int {
+	if depth > c.budget.MaxGroupDepth {
+		report.add(path, CodeBudgetExceeded,
+			fmt.Sprintf("groups are nested %d levels deep, the limit is %d", depth, c.budget.MaxGroupDepth),
+			"flatten nested groups that use the same combinator")
+		return 0
+	}
+
+	// Macros count with their expansion. Invalid references are reported
+	// while the groups are processed.
+	if group.Macro != "" {
+		expanded, ok := c.expandGroupMacro(group, path, &ValidationError{})
+		if !ok {
+			return 0
+		}
+		group, path = expanded, path+".macro"
+	}
+
+	filters := 0
+	for i, filter := range group.Filters {
+		filterPath := fmt.Sprintf("%s.filters[%d]", path, i)
+		if filter.Macro != "" {
+			if expanded, ok := c.expandFilterMacro(filter, filterPath, &ValidationError{}); ok {
+				filters += c.checkGroupBudget(expanded, filterPath+".macro", depth+1, report)
+			}
+			continue
+		}
+		filters++
+
+		if values, ok := filter.Value.([]interface{}); ok && len(values) > c.budget.MaxInValues {
+			report.add(filterPath+".value", CodeBudgetExceeded,
+				fmt.Sprintf("list has %d values, the limit is %d", len(values), c.budget.MaxInValues),
+				"split the list across several queries")
+		}
+		if filter.Where != nil {
+			filters += c.checkGroupBudget(*filter.Where, filterPath+".where", depth+1, report)
+		}
+	}
+
+	for i, nestedGroup := range group.Groups {
+		filters += c.checkGroupBudget(nestedGroup, fmt.Sprintf("%s.groups[%d]", path, i), depth+1, report)
+	}
+
+	return filters
+}
+
+// checkRelationsBudget checks selected relations at the given nesting depth
+// and the relations nested in them, and returns the number of filters they
+// contain. Each level returns up to a page of records per parent, so the
+// depth bounds how many records one query can fetch.
+func (c *Converter) checkRelationsBudget(relations []models.RelationSelection, path string, depth int, report *ValidationError) int {
+	filters := 0
+	for i, relation := range relations {
+		relationPath := fmt.Sprintf("%s.relations[%d]", path, i)
+		if depth > c.budget.MaxRelationDepth {
+			report.add(relationPath, CodeBudgetExceeded,
+				fmt.Sprintf("relations are nested %d levels deep, the limit is %d", depth, c.budget.MaxRelationDepth),
+				"query the nested records separately")
+			continue
+		}
+
+		if relation.Filter != nil {
+			filters += c.checkGroupBudget(*relation.Filter, relationPath+".filter", 1, report)
+		}
+		filters += c.checkRelationsBudget(relation.Relations, relationPath, depth+1, report)
+	}
+	return filters
+}
+
+// checkLimit reports a page size above the budget's maximum
+func (c *Converter) checkLimit(limit int, path string, report *ValidationError) {
+	if limit < 0 {
+		report.add(path, CodeInvalidValue, "limit must not be negative", "")
+		return
+	}
+	if limit > c.budget.MaxLimit {
+		report.add(path, CodeBudgetExceeded,
+			fmt.Sprintf("limit %d exceeds the maximum of %d", limit, c.budget.MaxLimit),
+			"page through the segment with cursor pagination")
+	}
+}
+
+// checkVarBlocks reports queries generating more var blocks than the budget allows
+func (c *Converter) checkVarBlocks(variables []VarBlock, report *ValidationError) {
+	if len(variables) > c.budget.MaxVarBlocks {
+		report.add("groups", CodeBudgetExceeded,
+			fmt.Sprintf("query needs %d var blocks, the limit is %d", len(variables), c.budget.MaxVarBlocks),
+			"use scoped groups to combine filters on the same related entity")
+	}
+}
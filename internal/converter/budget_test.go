@@ -0,0 +1,92 @@
+package converter
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	models "github.com/shahariaz/user_segmentation/internal/model"
+)
+
+func TestBudget(t *testing.T) {
+	budget := models.ComplexityBudget{
+		MaxLimit:         100,
+		MaxGroupDepth:    2,
+		MaxFilters:       2,
+		MaxInValues:      2,
+		MaxVarBlocks:     5,
+		MaxRelationDepth: 2,
+	}
+	relation := func(nested string) string {
+		return `{"entity":"watch_histories","fields":["watch_date"]` + nested + `}`
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		issues []string
+	}{
+		{
+			name:  "within the budget",
+			query: `{"combine_with":"AND","groups":[{"combine_with":"AND","filters":[{"field":"country","op":"IN","value":["US","CA"]}]}]}`,
+		},
+		{
+			name:   "too many filters",
+			query:  `{"combine_with":"AND","groups":[{"combine_with":"AND","filters":[{"field":"country","op":"=","value":"US"},{"field":"age","op":">","value":18},{"field":"age","op":"<","value":65}]}]}`,
+			issues: []string{"groups budget_exceeded"},
+		},
+		{
+			name:   "long list",
+			query:  `{"combine_with":"AND","groups":[{"combine_with":"AND","filters":[{"field":"country","op":"IN","value":["US","CA","MX"]}]}]}`,
+			issues: []string{"groups[0].filters[0].value budget_exceeded"},
+		},
+		{
+			name:   "nested groups",
+			query:  `{"combine_with":"AND","groups":[{"combine_with":"AND","groups":[{"combine_with":"AND","groups":[{"combine_with":"AND","filters":[{"field":"age","op":">","value":18}]}]}]}]}`,
+			issues: []string{"groups[0].groups[0].groups[0] budget_exceeded"},
+		},
+		{
+			name: "long list in a relation filter",
+			query: `{"combine_with":"AND","groups":[],"select":{"relations":[{"entity":"subscriptions",` +
+				`"filter":{"combine_with":"AND","filters":[{"field":"subscription_status","op":"IN","value":["active","trial","paused"]}]}}]}}`,
+			issues: []string{"select.relations[0].filter.filters[0].value budget_exceeded"},
+		},
+		{
+			name: "filters in a sort aggregate",
+			query: `{"combine_with":"AND","groups":[{"combine_with":"AND","filters":[{"field":"country","op":"=","value":"US"}]}],` +
+				`"sort":[{"aggregate":"count","relationship":"purchases","where":{"combine_with":"AND","filters":[{"field":"purchase_amount","op":">","value":5},{"field":"purchase_amount","op":"<","value":50}]}}]}`,
+			issues: []string{"groups budget_exceeded"},
+		},
+		{
+			name:  "relations at the depth limit",
+			query: `{"combine_with":"AND","groups":[],"select":{"relations":[` + relation(`,"relations":[{"entity":"contents","fields":["title"]}]`) + `]}}`,
+		},
+		{
+			name: "relations nested too deeply",
+			query: `{"combine_with":"AND","groups":[],"select":{"relations":[` +
+				relation(`,"relations":[{"entity":"contents","relations":[{"entity":"watch_histories"}]}]`) + `]}}`,
+			issues: []string{"select.relations[0].relations[0].relations[0] budget_exceeded"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewConverter(WithBudget(budget)).BuildQuery(parseQuery(t, tt.query))
+
+			var got []string
+			if validationErr, ok := err.(*ValidationError); ok {
+				for _, issue := range validationErr.Issues {
+					if issue.Code == CodeBudgetExceeded {
+						got = append(got, fmt.Sprintf("%s %s", issue.Path, issue.Code))
+					}
+				}
+			} else if err != nil {
+				t.Fatalf("BuildQuery: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.issues) {
+				t.Errorf("budget issues = %s, want %s", strings.Join(got, "; "), strings.Join(tt.issues, "; "))
+			}
+		})
+	}
+}
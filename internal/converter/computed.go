@@ -0,0 +1,158 @@
+package converter
+
+import (
+	"strconv"
+	"time"
+
+	models "github.com/shahariaz/user_segmentation/internal/model"
+)
+
+// unitRange is an inclusive range of whole units of a computed field. A nil
+// bound leaves that side open.
+type unitRange struct {
+	min *int
+	max *int
+}
+
+// buildComputedCondition rewrites a filter on a computed field into a range on
+// its source datetime predicate. "age > 30" selects ages of at least 31, which
+// is every date of birth on or before the date 31 years ago.
+func (c *Converter) buildComputedCondition(params *queryParams, mapping *models.FieldMapping, filter models.Filter) Expr {
+	switch filter.Op {
+	case "IS_NULL":
+		return c.buildNullCondition(mapping, true)
+	case "IS_NOT_NULL":
+		return c.buildNullCondition(mapping, false)
+	case "IN", "NOT_IN":
+		values, ok := filter.Value.([]interface{})
+		if !ok {
+			values = []interface{}{filter.Value}
+		}
+
+		var conditions []Expr
+		for _, value := range values {
+			n, ok := computedOperand(value)
+			if !ok {
+				return nil
+			}
+			conditions = append(conditions, c.buildUnitRange(params, mapping, unitRange{min: &n, max: &n}))
+		}
+
+		if filter.Op == "NOT_IN" {
+			return newNot(newOr(conditions...))
+		}
+		return newOr(conditions...)
+	case "BETWEEN":
+		low, high, ok := betweenOperands(filter.Value)
+		if !ok {
+			return nil
+		}
+		min, minOk := computedOperand(low)
+		max, maxOk := computedOperand(high)
+		if !minOk || !maxOk {
+			return nil
+		}
+		return c.buildUnitRange(params, mapping, unitRange{min: &min, max: &max})
+	}
+
+	n, ok := computedOperand(filter.Value)
+	if !ok {
+		return nil
+	}
+	above, below := n+1, n-1
+
+	switch filter.Op {
+	case "=":
+		return c.buildUnitRange(params, mapping, unitRange{min: &n, max: &n})
+	case "!=":
+		return newNot(c.buildUnitRange(params, mapping, unitRange{min: &n, max: &n}))
+	case ">":
+		return c.buildUnitRange(params, mapping, unitRange{min: &above})
+	case ">=":
+		return c.buildUnitRange(params, mapping, unitRange{min: &n})
+	case "<":
+		return c.buildUnitRange(params, mapping, unitRange{max: &below})
+	case "<=":
+		return c.buildUnitRange(params, mapping, unitRange{max: &n})
+	default:
+		return nil
+	}
+}
+
+// buildUnitRange converts a range of whole units into datetime comparisons.
+// Counting since a date, N or more units have passed when the date is at or
+// before now minus N units. Counting until a date, N or more remain when it is
+// at or after now plus N units.
+func (c *Converter) buildUnitRange(params *queryParams, mapping *models.FieldMapping, units unitRange) Expr {
+	var conditions []Expr
+
+	bound := func(function string, n int) {
+		value := params.bind(c.shiftByUnits(mapping.Computed, n).Format(time.RFC3339), "string")
+		conditions = append(conditions, newComparison(function, mapping.DgraphField, value))
+	}
+
+	if mapping.Computed.Direction == "until" {
+		if units.min != nil {
+			bound("ge", *units.min)
+		}
+		if units.max != nil {
+			bound("lt", *units.max+1)
+		}
+	} else {
+		if units.min != nil {
+			bound("le", *units.min)
+		}
+		if units.max != nil {
+			bound("gt", *units.max+1)
+		}
+	}
+
+	return newAnd(conditions...)
+}
+
+// shiftByUnits returns the time n units away from now in the direction the
+// computed field counts
+func (c *Converter) shiftByUnits(computed *models.ComputedField, n int) time.Time {
+	if computed.Direction != "until" {
+		n = -n
+	}
+
+	now := c.now().UTC()
+	if computed.Unit == "years" {
+		return now.AddDate(n, 0, 0)
+	}
+	return now.AddDate(0, 0, n)
+}
+
+// computedOperand reads a whole number of units from a filter value
+func computedOperand(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case float64:
+		if v != float64(int(v)) {
+			return 0, false
+		}
+		return int(v), true
+	case string:
+		n, err := strconv.Atoi(v)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// betweenOperands returns the bounds of a BETWEEN value given either as
+// [min, max] or as {"min": .., "max": ..}
+func betweenOperands(value interface{}) (interface{}, interface{}, bool) {
+	switch v := value.(type) {
+	case []interface{}:
+		if len(v) == 2 {
+			return v[0], v[1], true
+		}
+	case map[string]interface{}:
+		low, hasMin := v["min"]
+		high, hasMax := v["max"]
+		return low, high, hasMin && hasMax
+	}
+	return nil, nil, false
+}
@@ -2,8 +2,10 @@ package converter
 
 import (
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/shahariaz/user_segmentation/internal/config"
 	models "github.com/shahariaz/user_segmentation/internal/model"
@@ -15,29 +17,82 @@ type Converter struct {
 	operators         map[string]string
 	versionFields     map[string]string
 	reversePredicates map[string]string
+	predicates        map[string]models.PredicateSchema
+	macros            map[string]models.FilterMacro
+	pagination        map[string]int
+	budget            models.ComplexityBudget
+	now               func() time.Time
 }
 
-func NewConverter() *Converter {
+// Option customizes a Converter created by NewConverter
+type Option func(*Converter)
+
+// WithClock sets the clock used to resolve relative datetime expressions
+func WithClock(now func() time.Time) Option {
+	return func(c *Converter) {
+		c.now = now
+	}
+}
+
+func NewConverter(opts ...Option) *Converter {
 	schema := config.GetSchemaConfig()
-	return &Converter{
+	c := &Converter{
 		schema:            schema,
 		operators:         config.GetOperatorMappings(),
 		versionFields:     config.GetVersionFields(),
 		reversePredicates: config.GetReversePredicates(),
+		predicates:        config.GetPredicateSchema(),
+		macros:            config.GetFilterOptimizations(),
+		pagination:        config.GetPaginationConfig(),
+		budget:            config.GetComplexityBudget(),
+		now:               time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(c)
 	}
+
+	return c
 }
 
 func (c *Converter) ConvertToDQL(jsonQuery *models.JSONQuery) (*models.DQLQuery, error) {
-	const mainEntityType = "customers"
+	query, err := c.BuildQuery(jsonQuery)
+	if err != nil {
+		return nil, err
+	}
+	return Print(query), nil
+}
 
-	var variables []models.VariableBlock
+// BuildQuery validates a JSON query and compiles it into a query tree
+func (c *Converter) BuildQuery(jsonQuery *models.JSONQuery) (*Query, error) {
+	var variables []VarBlock
 	varCounter := 0
+	report := &ValidationError{}
+	params := &queryParams{}
 
-	var groupExpressions []string
+	mainEntityType := jsonQuery.TargetEntity
+	if mainEntityType == "" {
+		mainEntityType = hubEntityType
+	}
+	if !c.isEntityType(mainEntityType) {
+		report.add("target_entity", CodeUnknownEntity,
+			fmt.Sprintf("unknown entity type %q", mainEntityType),
+			"use one of: "+strings.Join(c.schema.EntityTypes, ", "))
+		return nil, report
+	}
 
-	for _, group := range jsonQuery.Groups {
-		groupExpr, vars, counter := c.processGroup(group, mainEntityType, varCounter)
-		if groupExpr != "" {
+	c.validateCombinator(jsonQuery.CombineWith, "", report)
+	c.checkBudget(jsonQuery, report)
+	if report.hasIssues() {
+		return nil, report
+	}
+
+	var groupExpressions []Expr
+
+	for i, group := range jsonQuery.Groups {
+		path := fmt.Sprintf("groups[%d]", i)
+		groupExpr, vars, counter := c.processGroup(group, mainEntityType, varCounter, path, report, params)
+		if groupExpr != nil {
 
 			groupExpressions = append(groupExpressions, groupExpr)
 			variables = append(variables, vars...)
@@ -46,513 +101,804 @@ func (c *Converter) ConvertToDQL(jsonQuery *models.JSONQuery) (*models.DQLQuery,
 		}
 	}
 
-	var mainFilter string
+	selection := c.buildFieldsSelection(mainEntityType)
+	if jsonQuery.Select != nil {
+		selection = c.buildSelection(jsonQuery.Select, mainEntityType, "select", report, params)
+	}
+
+	ordering, sortVars, varCounter := c.buildMainOrdering(jsonQuery.Sort, mainEntityType, varCounter, report, params)
+	variables = append(variables, sortVars...)
+
+	page := c.buildPagination(jsonQuery, mainEntityType, report)
+
+	if report.hasIssues() {
+		return nil, report
+	}
+
+	combiner := "AND"
+	if strings.ToUpper(jsonQuery.CombineWith) == "OR" {
+		combiner = "OR"
+	}
+
+	var mainFilter Expr
 	if len(groupExpressions) > 0 {
-		combiner := " AND "
-		if strings.ToUpper(jsonQuery.CombineWith) == "OR" {
-			combiner = " OR "
-		}
+		mainFilter = &BoolOp{Op: combiner, Operands: groupExpressions}
+	}
 
-		if len(groupExpressions) == 1 {
-			mainFilter = fmt.Sprintf("@filter(%s)", groupExpressions[0])
-		} else {
-			combinedFilter := strings.Join(groupExpressions, combiner)
-			mainFilter = fmt.Sprintf("@filter(%s)", combinedFilter)
-		}
+	query := &Query{
+		Vars:      variables,
+		Name:      mainEntityType,
+		Type:      mainEntityType,
+		Root:      newComparison("type", "", mainEntityType),
+		Filter:    mainFilter,
+		Selection: selection,
+		Order:     ordering,
+		Page:      page,
+		Params:    params.list,
+		Warnings:  c.checkLogic(jsonQuery, mainEntityType),
 	}
 
-	limit := jsonQuery.Limit
-	offset := jsonQuery.Offset
-	if limit == 0 {
-		limit = 100
+	// The budget applies to the var blocks left once redundant ones are merged
+	c.simplifyQuery(query)
+	rewriteQuery(query)
+	c.checkVarBlocks(query.Vars, report)
+	if report.hasIssues() {
+		return nil, report
 	}
-	pagination := fmt.Sprintf("first: %d, offset: %d", limit, offset)
 
-	mainQuery := models.MainQuery{
-		Name:       "customers",
-		Type:       mainEntityType,
-		Function:   fmt.Sprintf("type(%s)", mainEntityType),
-		Filter:     mainFilter,
-		Fields:     c.buildFieldsSelection(mainEntityType),
-		Pagination: pagination,
+	c.chooseRoot(query)
+	return query, nil
+}
+
+// ConvertToCountDQL converts a JSON query into a DQL query with the same filter
+// and var blocks whose main block only returns count(uid). Projection, sorting
+// and pagination are ignored since no rows are fetched.
+func (c *Converter) ConvertToCountDQL(jsonQuery *models.JSONQuery) (*models.DQLQuery, error) {
+	countQuery := *jsonQuery
+	countQuery.Select = nil
+	countQuery.Sort = nil
+	countQuery.Cursor = ""
+	countQuery.Limit = 0
+	countQuery.Offset = 0
+
+	query, err := c.BuildQuery(&countQuery)
+	if err != nil {
+		return nil, err
 	}
 
-	return &models.DQLQuery{
-		Variables: variables,
-		MainQuery: mainQuery,
-	}, nil
+	query.Selection = Selection{Count: true}
+	query.Order = nil
+	query.Page = nil
+
+	return Print(query), nil
 }
 
-// processGroup processes a single group and returns the filter expression, variables, and updated counter
-func (c *Converter) processGroup(group models.Group, mainEntityType string, varCounter int) (string, []models.VariableBlock, int) {
-	var variables []models.VariableBlock
-	var filterExpressions []string
+// processGroup processes a single group and returns the filter expression, variables, and updated counter.
+// Problems found in the group are recorded in report using path as the JSON path prefix.
+func (c *Converter) processGroup(group models.Group, mainEntityType string, varCounter int, path string, report *ValidationError, params *queryParams) (Expr, []VarBlock, int) {
+	var variables []VarBlock
+	var filterExpressions []Expr
+
+	if group.Macro != "" {
+		expanded, ok := c.expandGroupMacro(group, path, report)
+		if !ok {
+			return nil, variables, varCounter
+		}
+		group, path = expanded, path+".macro"
+	}
+
+	if group.Scope != "" {
+		return c.processScopedGroup(group, mainEntityType, varCounter, path, report, params)
+	}
 
-	isOrGroup := strings.ToUpper(group.CombineWith) == "OR"
+	c.validateCombinator(group.CombineWith, path, report)
 
-	for _, filter := range group.Filters {
-		expr, vars, counter := c.processFilter(filter, mainEntityType, varCounter)
-		if expr != "" {
+	for i, filter := range group.Filters {
+		filterPath := fmt.Sprintf("%s.filters[%d]", path, i)
+		var expr Expr
+		var vars []VarBlock
+		var counter int
+		if filter.Macro != "" {
+			if expanded, ok := c.expandFilterMacro(filter, filterPath, report); ok {
+				expr, vars, counter = c.processGroup(expanded, mainEntityType, varCounter, filterPath+".macro", report, params)
+			}
+		} else {
+			expr, vars, counter = c.processFilter(filter, mainEntityType, varCounter, filterPath, report, params)
+		}
+		if expr != nil {
 			filterExpressions = append(filterExpressions, expr)
 			variables = append(variables, vars...)
 			varCounter = counter
 		}
 	}
 
-	for _, nestedGroup := range group.Groups {
-		expr, vars, counter := c.processGroup(nestedGroup, mainEntityType, varCounter)
-		if expr != "" {
+	for i, nestedGroup := range group.Groups {
+		groupPath := fmt.Sprintf("%s.groups[%d]", path, i)
+		expr, vars, counter := c.processGroup(nestedGroup, mainEntityType, varCounter, groupPath, report, params)
+		if expr != nil {
 			filterExpressions = append(filterExpressions, expr)
 			variables = append(variables, vars...)
 			varCounter = counter
 		}
 	}
 
-	if len(filterExpressions) == 0 {
-		return "", variables, varCounter
-	}
+	return groupExpression(group, filterExpressions), variables, varCounter
+}
 
-	// Combine expressions based on group's combine_with
-	combiner := " AND "
-	if isOrGroup {
-		combiner = " OR "
+// groupExpression combines the expressions of a group's filters and nested
+// groups with its combinator, negated when the group is
+func groupExpression(group models.Group, expressions []Expr) Expr {
+	if len(expressions) == 0 {
+		return nil
 	}
 
-	var groupExpression string
-	if len(filterExpressions) == 1 {
-		groupExpression = filterExpressions[0]
+	var expr Expr
+	if strings.ToUpper(group.CombineWith) == "OR" {
+		expr = newOr(expressions...)
 	} else {
-		groupExpression = "(" + strings.Join(filterExpressions, combiner) + ")"
+		expr = newAnd(expressions...)
 	}
 
-	return groupExpression, variables, varCounter
+	if group.Negate {
+		return newNot(expr)
+	}
+	return expr
 }
 
-func (c *Converter) processFilter(filter models.Filter, mainEntityType string, varCounter int) (string, []models.VariableBlock, int) {
-	var variables []models.VariableBlock
-
-	mappings, exists := c.schema.FieldMappings[filter.Field]
-	if !exists {
-		return "", variables, varCounter
+// processScopedGroup compiles a group whose filters must all hold on the same
+// record of the scope entity into a single var block with a combined @filter
+func (c *Converter) processScopedGroup(group models.Group, mainEntityType string, varCounter int, path string, report *ValidationError, params *queryParams) (Expr, []VarBlock, int) {
+	var variables []VarBlock
+
+	if !c.isEntityType(group.Scope) {
+		report.add(path+".scope", CodeUnknownEntity,
+			fmt.Sprintf("unknown entity type %q", group.Scope),
+			"use one of: "+strings.Join(c.schema.EntityTypes, ", "))
+		return nil, variables, varCounter
+	}
+
+	var predicates []string
+	if group.Scope != mainEntityType {
+		predicates = c.relationshipPath(mainEntityType, group.Scope)
+		if predicates == nil {
+			report.add(path+".scope", CodeUnreachableEntity,
+				fmt.Sprintf("entity %q cannot be reached from %q", group.Scope, mainEntityType),
+				fmt.Sprintf("scope the group to %s or an entity related to it", mainEntityType))
+			return nil, variables, varCounter
+		}
 	}
 
-	var mainEntityMapping *models.FieldMapping
-	var crossEntityMapping *models.FieldMapping
+	if len(predicates) == 0 {
+		return c.buildScopedCondition(group, group.Scope, path, report, params), variables, varCounter
+	}
 
-	for _, mapping := range mappings {
-		if mapping.EntityType == mainEntityType {
-			mainEntityMapping = &mapping
-			break
-		}
+	// A negated scope excludes roots with a matching record rather than
+	// matching records that fail the group
+	matching := group
+	matching.Negate = false
+	condition := c.buildScopedCondition(matching, group.Scope, path, report, params)
+	if condition == nil {
+		return nil, variables, varCounter
 	}
 
-	if mainEntityMapping == nil && len(mappings) > 0 {
-		crossEntityMapping = &mappings[0]
+	varName := fmt.Sprintf("var%d", varCounter)
+	varCounter++
+
+	variables = append(variables, VarBlock{
+		Name:      varName,
+		Type:      mainEntityType,
+		Traversal: &Traversal{Edges: predicates, Filter: condition},
+	})
+
+	if group.Negate {
+		return newNot(&VarRef{Name: varName}), variables, varCounter
 	}
+	return &VarRef{Name: varName}, variables, varCounter
+}
+
+// buildScopedCondition combines the filters and nested groups of a scoped group
+// into one condition evaluated on the scope entity
+func (c *Converter) buildScopedCondition(group models.Group, scope string, path string, report *ValidationError, params *queryParams) Expr {
+	var conditions []Expr
 
-	if mainEntityMapping != nil {
-		condition := c.buildDQLCondition(mainEntityMapping, filter)
-		if condition != "" {
-			return condition, variables, varCounter
+	if group.Macro != "" {
+		expanded, ok := c.expandGroupMacro(group, path, report)
+		if !ok {
+			return nil
 		}
+		group, path = expanded, path+".macro"
 	}
 
-	// Handle cross-entity filters
-	if crossEntityMapping != nil {
-		varName := fmt.Sprintf("var%d", varCounter)
-		varCounter++
+	c.validateCombinator(group.CombineWith, path, report)
+
+	if group.Scope != "" && group.Scope != scope {
+		report.add(path+".scope", CodeInvalidScope,
+			fmt.Sprintf("nested group scope %q differs from enclosing scope %q", group.Scope, scope),
+			"move the group out of the scoped group or use the same scope")
+		return nil
+	}
+
+	for i, filter := range group.Filters {
+		filterPath := fmt.Sprintf("%s.filters[%d]", path, i)
+		if filter.Macro != "" {
+			if expanded, ok := c.expandFilterMacro(filter, filterPath, report); ok {
+				if condition := c.buildScopedCondition(expanded, scope, filterPath+".macro", report, params); condition != nil {
+					conditions = append(conditions, condition)
+				}
+			}
+			continue
+		}
+		if filter.Op == "HAS_NONE" {
+			report.add(filterPath+".op", CodeInvalidScope,
+				"HAS_NONE cannot be used inside a scoped group",
+				"move the filter out of the scoped group")
+			continue
+		}
+		if !c.validateFilter(filter, filterPath, report) {
+			continue
+		}
 
-		filterCondition := c.buildDQLCondition(crossEntityMapping, filter)
-		if filterCondition == "" {
-			return "", variables, varCounter
+		mapping := c.relationshipFieldMapping(filter.Field, scope)
+		if mapping == nil {
+			report.add(filterPath+".field", CodeInvalidScope,
+				fmt.Sprintf("field %q is not a field of scope entity %q", filter.Field, scope),
+				"move the filter out of the scoped group")
+			continue
 		}
 
-		forwardPredicate := c.getForwardPredicate(crossEntityMapping.EntityType)
-		if forwardPredicate == "" {
-			return "", variables, varCounter
+		if !c.checkIndexSupport(mapping, filter, filterPath, report) {
+			continue
 		}
 
-		variable := models.VariableBlock{
-			Name:   varName,
-			Type:   mainEntityType,
-			Filter: "",
-			Fields: fmt.Sprintf("    %s @filter(%s)", forwardPredicate, filterCondition),
+		condition := c.buildDQLCondition(params, mapping, filter)
+		if condition == nil {
+			report.add(filterPath+".value", CodeInvalidValue,
+				fmt.Sprintf("value cannot be used with operator %q on field %q", filter.Op, filter.Field), "")
+			continue
 		}
+		conditions = append(conditions, condition)
+	}
 
-		variables = append(variables, variable)
-		return fmt.Sprintf("uid(%s)", varName), variables, varCounter
+	for i, nestedGroup := range group.Groups {
+		groupPath := fmt.Sprintf("%s.groups[%d]", path, i)
+		if condition := c.buildScopedCondition(nestedGroup, scope, groupPath, report, params); condition != nil {
+			conditions = append(conditions, condition)
+		}
 	}
 
-	return "", variables, varCounter
+	return groupExpression(group, conditions)
 }
 
-func (c *Converter) getForwardPredicate(entityType string) string {
-	switch entityType {
-	case "subscriptions":
-		return "customers.subscriptions"
-	case "devices":
-		return "customers.devices"
-	case "watch_histories":
-		return "customers.watch_histories"
-	case "purchases":
-		return "customers.purchases"
-	default:
-		return ""
+func (c *Converter) processFilter(filter models.Filter, mainEntityType string, varCounter int, path string, report *ValidationError, params *queryParams) (Expr, []VarBlock, int) {
+	var variables []VarBlock
+
+	if filter.Aggregate != "" {
+		return c.processAggregateFilter(filter, mainEntityType, varCounter, path, report, params)
+	}
+	if filter.Op == "HAS_NONE" {
+		return c.processHasNoneFilter(filter, mainEntityType, varCounter, path, report, params)
+	}
+
+	if !c.validateFilter(filter, path, report) {
+		return nil, variables, varCounter
+	}
+
+	mapping, predicates := c.resolveMapping(c.schema.FieldMappings[filter.Field], mainEntityType)
+	if mapping == nil {
+		entityType := c.schema.FieldMappings[filter.Field][0].EntityType
+		report.add(path+".field", CodeUnreachableEntity,
+			fmt.Sprintf("field %q belongs to entity %q, which cannot be reached from %q",
+				filter.Field, entityType, mainEntityType),
+			fmt.Sprintf("filter on a field of %s or of an entity related to it", mainEntityType))
+		return nil, variables, varCounter
+	}
+
+	if !c.checkIndexSupport(mapping, filter, path, report) {
+		return nil, variables, varCounter
+	}
+
+	// A missing value on a related entity means no related record has one, not
+	// that some related record lacks it
+	if filter.Op == "IS_NULL" && len(predicates) > 0 {
+		present := filter
+		present.Op = "IS_NOT_NULL"
+		condition := c.buildDQLCondition(params, mapping, present)
+		return c.buildHasNoneBlock(predicates, condition, mainEntityType, varCounter)
+	}
+
+	if len(predicates) > 0 && (filter.Op == "CONTAINS_ALL" || filter.Op == "CONTAINS_NONE") {
+		return c.processRelatedListFilter(filter, mapping, predicates, mainEntityType, varCounter, path, report, params)
+	}
+
+	condition := c.buildDQLCondition(params, mapping, filter)
+	if condition == nil {
+		report.add(path+".value", CodeInvalidValue,
+			fmt.Sprintf("value cannot be used with operator %q on field %q", filter.Op, filter.Field), "")
+		return nil, variables, varCounter
 	}
+
+	if len(predicates) == 0 {
+		return condition, variables, varCounter
+	}
+
+	// Handle cross-entity filters
+	varName := fmt.Sprintf("var%d", varCounter)
+	varCounter++
+
+	variable := VarBlock{
+		Name:      varName,
+		Type:      mainEntityType,
+		Traversal: &Traversal{Edges: predicates, Filter: condition},
+	}
+
+	variables = append(variables, variable)
+	return &VarRef{Name: varName}, variables, varCounter
 }
 
-func (c *Converter) buildFieldsSelection(entityType string) string {
+func (c *Converter) buildFieldsSelection(entityType string) Selection {
 	fields := c.schema.DefaultFields[entityType]
 	if len(fields) == 0 {
-		return "    uid\n    expand(_all_)"
-	}
-
-	var fieldLines []string
-	for _, field := range fields {
-		fieldLines = append(fieldLines, "    "+field)
+		return Selection{Fields: []string{"uid"}, ExpandAll: true}
 	}
 
-	return strings.Join(fieldLines, "\n")
+	return Selection{Fields: fields}
 }
 
-func (c *Converter) buildDQLCondition(mapping *models.FieldMapping, filter models.Filter) string {
+func (c *Converter) buildDQLCondition(params *queryParams, mapping *models.FieldMapping, filter models.Filter) Expr {
 	dqlFunction := c.operators[filter.Op]
 	if dqlFunction == "" {
-		return ""
+		return nil
+	}
+
+	if mapping.Computed != nil {
+		return c.buildComputedCondition(params, mapping, filter)
 	}
 
 	switch filter.Op {
 	case "IN":
-		return c.buildInCondition(mapping, filter)
+		return c.buildInCondition(params, mapping, filter)
 	case "NOT_IN":
-		return c.buildNotInCondition(mapping, filter)
+		return c.buildNotInCondition(params, mapping, filter)
 	case "=", ">=", "<=", ">", "<", "!=":
-		return c.buildComparisonCondition(mapping, filter, dqlFunction)
-	case "LIKE", "ILIKE", "CONTAINS":
-		return c.buildTextSearchCondition(mapping, filter, filter.Op)
+		return c.buildComparisonCondition(params, mapping, filter, dqlFunction)
+	case "LIKE", "ILIKE":
+		return c.buildLikeCondition(params, mapping, filter)
+	case "CONTAINS":
+		return c.buildTextSearchCondition(params, mapping, filter, filter.Op)
 	case "REGEX":
 		return c.buildRegexCondition(mapping, filter)
 	case "BETWEEN":
-		return c.buildBetweenCondition(mapping, filter)
+		return c.buildBetweenCondition(params, mapping, filter)
 	case "IS_NULL":
 		return c.buildNullCondition(mapping, true)
 	case "IS_NOT_NULL":
 		return c.buildNullCondition(mapping, false)
 	case "STARTS_WITH":
-		return c.buildStringPatternCondition(mapping, filter, "starts_with")
+		return c.buildStringPatternCondition(params, mapping, filter, "starts_with")
 	case "ENDS_WITH":
-		return c.buildStringPatternCondition(mapping, filter, "ends_with")
+		return c.buildStringPatternCondition(params, mapping, filter, "ends_with")
+	case "CONTAINS_ANY", "CONTAINS_ALL", "CONTAINS_NONE":
+		return c.buildListCondition(params, mapping, filter)
+	case "VERSION_RANGE":
+		return c.buildVersionRangeCondition(params, mapping, filter)
 	default:
-		return ""
+		return nil
 	}
 }
 
-func (c *Converter) buildInCondition(mapping *models.FieldMapping, filter models.Filter) string {
+func (c *Converter) buildInCondition(params *queryParams, mapping *models.FieldMapping, filter models.Filter) Expr {
 	switch v := filter.Value.(type) {
 	case []interface{}:
-		var conditions []string
+		var conditions []Expr
 		for _, item := range v {
-			value := c.formatValue(item, mapping.DataType)
+			value := c.bindValue(params, item, mapping.DataType)
 			if value != "" {
-				conditions = append(conditions, fmt.Sprintf("eq(%s, %s)", mapping.DgraphField, value))
+				conditions = append(conditions, newComparison("eq", mapping.DgraphField, value))
 			}
 		}
-
-		if len(conditions) > 1 {
-			return "(" + strings.Join(conditions, " OR ") + ")"
-		} else if len(conditions) == 1 {
-			return conditions[0]
-		}
+		return newOr(conditions...)
 
 	case map[string]interface{}:
-		return c.buildComplexObjectCondition(mapping, v)
+		return c.buildComplexObjectCondition(params, mapping, v)
 
 	default:
-		value := c.formatValue(v, mapping.DataType)
+		value := c.bindValue(params, v, mapping.DataType)
 		if value != "" {
-			return fmt.Sprintf("eq(%s, %s)", mapping.DgraphField, value)
+			return newComparison("eq", mapping.DgraphField, value)
 		}
 	}
 
-	return ""
+	return nil
 }
 
-func (c *Converter) buildNotInCondition(mapping *models.FieldMapping, filter models.Filter) string {
+func (c *Converter) buildNotInCondition(params *queryParams, mapping *models.FieldMapping, filter models.Filter) Expr {
 	switch v := filter.Value.(type) {
 	case []interface{}:
-		var conditions []string
+		var conditions []Expr
 		for _, item := range v {
-			value := c.formatValue(item, mapping.DataType)
+			value := c.bindValue(params, item, mapping.DataType)
 			if value != "" {
-				conditions = append(conditions, fmt.Sprintf("eq(%s, %s)", mapping.DgraphField, value))
+				conditions = append(conditions, newComparison("eq", mapping.DgraphField, value))
 			}
 		}
 
-		if len(conditions) > 1 {
-			return "NOT (" + strings.Join(conditions, " OR ") + ")"
-		} else if len(conditions) == 1 {
-			return "NOT " + conditions[0]
+		if len(conditions) > 0 {
+			return newNot(newOr(conditions...))
 		}
 	default:
-		value := c.formatValue(v, mapping.DataType)
+		value := c.bindValue(params, v, mapping.DataType)
 		if value != "" {
-			return fmt.Sprintf("NOT eq(%s, %s)", mapping.DgraphField, value)
+			return newNot(newComparison("eq", mapping.DgraphField, value))
+		}
+	}
+	return nil
+}
+
+// buildListCondition matches the elements of a list-valued predicate on one
+// record. eq on a [string] predicate holds when any element equals the value,
+// so ANY joins the terms with OR, ALL with AND and NONE negates ANY. Filters on
+// a related entity's list go through processRelatedListFilter instead.
+func (c *Converter) buildListCondition(params *queryParams, mapping *models.FieldMapping, filter models.Filter) Expr {
+	values, ok := filter.Value.([]interface{})
+	if !ok {
+		values = []interface{}{filter.Value}
+	}
+
+	var conditions []Expr
+	for _, item := range values {
+		value := c.bindValue(params, item, mapping.DataType)
+		if value == "" {
+			return nil
+		}
+		conditions = append(conditions, newComparison("eq", mapping.DgraphField, value))
+	}
+
+	if len(conditions) == 0 {
+		return nil
+	}
+
+	switch filter.Op {
+	case "CONTAINS_ALL":
+		return newAnd(conditions...)
+	case "CONTAINS_NONE":
+		return newNot(newOr(conditions...))
+	default:
+		return newOr(conditions...)
+	}
+}
+
+// processRelatedListFilter compiles CONTAINS_ALL and CONTAINS_NONE on a list
+// predicate of a related entity, whose values may be spread over several
+// related records. ALL collects the roots reaching a record with each value
+// in a var block per value and requires all of them. NONE collects the roots
+// reaching a record with any of the values and excludes them, so that a root
+// with one Horror and one Comedy record is not kept by "not Horror".
+func (c *Converter) processRelatedListFilter(filter models.Filter, mapping *models.FieldMapping, predicates []string, mainEntityType string, varCounter int, path string, report *ValidationError, params *queryParams) (Expr, []VarBlock, int) {
+	values, ok := filter.Value.([]interface{})
+	if !ok {
+		values = []interface{}{filter.Value}
+	}
+
+	matching := func(values []interface{}) Expr {
+		anyFilter := filter
+		anyFilter.Op = "CONTAINS_ANY"
+		anyFilter.Value = values
+		condition := c.buildListCondition(params, mapping, anyFilter)
+		if condition == nil {
+			report.add(path+".value", CodeInvalidValue,
+				fmt.Sprintf("value cannot be used with operator %q on field %q", filter.Op, filter.Field), "")
 		}
+		return condition
 	}
-	return ""
+
+	if filter.Op == "CONTAINS_NONE" {
+		condition := matching(values)
+		if condition == nil {
+			return nil, nil, varCounter
+		}
+		return c.buildHasNoneBlock(predicates, condition, mainEntityType, varCounter)
+	}
+
+	var variables []VarBlock
+	var references []Expr
+	for _, value := range values {
+		condition := matching([]interface{}{value})
+		if condition == nil {
+			return nil, nil, varCounter
+		}
+
+		varName := fmt.Sprintf("var%d", varCounter)
+		varCounter++
+
+		variables = append(variables, VarBlock{
+			Name:      varName,
+			Type:      mainEntityType,
+			Traversal: &Traversal{Edges: predicates, Filter: condition},
+		})
+		references = append(references, &VarRef{Name: varName})
+	}
+
+	return newAnd(references...), variables, varCounter
 }
 
-func (c *Converter) buildComparisonCondition(mapping *models.FieldMapping, filter models.Filter, dqlFunction string) string {
+func (c *Converter) buildComparisonCondition(params *queryParams, mapping *models.FieldMapping, filter models.Filter, dqlFunction string) Expr {
 
 	if mode, isVersionField := c.versionFields[filter.Field]; isVersionField && mode == "numeric" {
-		return c.buildVersionComparisonCondition(mapping, filter, dqlFunction)
+		return c.buildVersionComparisonCondition(params, mapping, filter, dqlFunction)
 	}
 
-	value := c.formatValue(filter.Value, mapping.DataType)
+	value := c.bindValue(params, filter.Value, mapping.DataType)
 	if value == "" {
-		return ""
+		return nil
 	}
 
 	if filter.Op == "!=" {
-		return fmt.Sprintf("NOT eq(%s, %s)", mapping.DgraphField, value)
+		return newNot(newComparison("eq", mapping.DgraphField, value))
 	}
 
-	return fmt.Sprintf("%s(%s, %s)", dqlFunction, mapping.DgraphField, value)
+	return newComparison(dqlFunction, mapping.DgraphField, value)
 }
 
-func (c *Converter) buildTextSearchCondition(mapping *models.FieldMapping, filter models.Filter, op string) string {
-	value := c.formatValue(filter.Value, "string")
+func (c *Converter) buildTextSearchCondition(params *queryParams, mapping *models.FieldMapping, filter models.Filter, op string) Expr {
+	value := c.bindValue(params, filter.Value, "string")
 	if value == "" {
-		return ""
+		return nil
 	}
 
 	switch op {
-	case "LIKE", "CONTAINS":
-		return fmt.Sprintf("alloftext(%s, %s)", mapping.DgraphField, value)
-	case "ILIKE":
-		return fmt.Sprintf("anyoftext(%s, %s)", mapping.DgraphField, value)
+	case "CONTAINS":
+		function := c.textFunction(mapping.DgraphField)
+		if function == "" {
+			return nil
+		}
+		return newComparison(function, mapping.DgraphField, value)
 	default:
-		return ""
+		return nil
 	}
 }
 
-func (c *Converter) buildRegexCondition(mapping *models.FieldMapping, filter models.Filter) string {
-	value := c.formatValue(filter.Value, "string")
-	if value == "" {
-		return ""
+func (c *Converter) buildRegexCondition(mapping *models.FieldMapping, filter models.Filter) Expr {
+	pattern, ok := filter.Value.(string)
+	if !ok || pattern == "" {
+		return nil
+	}
+	if _, err := regexp.Compile(pattern); err != nil {
+		return nil
 	}
-	return fmt.Sprintf("regexp(%s, %s)", mapping.DgraphField, value)
+	return newComparison("regexp", mapping.DgraphField, regexLiteral(pattern))
 }
 
-func (c *Converter) buildBetweenCondition(mapping *models.FieldMapping, filter models.Filter) string {
-	switch v := filter.Value.(type) {
-	case []interface{}:
-		if len(v) == 2 {
-			min := c.formatValue(v[0], mapping.DataType)
-			max := c.formatValue(v[1], mapping.DataType)
-			if min != "" && max != "" {
-				return fmt.Sprintf("(ge(%s, %s) AND le(%s, %s))",
-					mapping.DgraphField, min, mapping.DgraphField, max)
-			}
-		}
-	case map[string]interface{}:
-		if minVal, hasMin := v["min"]; hasMin {
-			if maxVal, hasMax := v["max"]; hasMax {
-				min := c.formatValue(minVal, mapping.DataType)
-				max := c.formatValue(maxVal, mapping.DataType)
-				if min != "" && max != "" {
-					return fmt.Sprintf("(ge(%s, %s) AND le(%s, %s))",
-						mapping.DgraphField, min, mapping.DgraphField, max)
-				}
-			}
-		}
+func (c *Converter) buildBetweenCondition(params *queryParams, mapping *models.FieldMapping, filter models.Filter) Expr {
+	low, high, ok := betweenOperands(filter.Value)
+	if !ok {
+		return nil
+	}
+
+	min := c.bindValue(params, low, mapping.DataType)
+	max := c.bindValue(params, high, mapping.DataType)
+	if min == "" || max == "" {
+		return nil
 	}
-	return ""
+
+	return newAnd(newComparison("ge", mapping.DgraphField, min), newComparison("le", mapping.DgraphField, max))
 }
 
-func (c *Converter) buildNullCondition(mapping *models.FieldMapping, isNull bool) string {
+func (c *Converter) buildNullCondition(mapping *models.FieldMapping, isNull bool) Expr {
 	if isNull {
-		return fmt.Sprintf("NOT has(%s)", mapping.DgraphField)
+		return newNot(newComparison("has", mapping.DgraphField))
 	}
-	return fmt.Sprintf("has(%s)", mapping.DgraphField)
+	return newComparison("has", mapping.DgraphField)
 }
 
-func (c *Converter) buildStringPatternCondition(mapping *models.FieldMapping, filter models.Filter, pattern string) string {
-	value := c.formatValue(filter.Value, "string")
-	if value == "" {
-		return ""
+func (c *Converter) buildStringPatternCondition(params *queryParams, mapping *models.FieldMapping, filter models.Filter, pattern string) Expr {
+	value, ok := filter.Value.(string)
+	if !ok || value == "" {
+		return nil
 	}
 
-	cleanValue := strings.Trim(value, `"`)
+	if pattern == "starts_with" && c.usePrefixRange(mapping.DgraphField, value) {
+		lower := newComparison("ge", mapping.DgraphField, params.bind(value, "string"))
+		upper, bounded := prefixUpperBound(value)
+		if !bounded {
+			return lower
+		}
+		return newAnd(lower, newComparison("lt", mapping.DgraphField, params.bind(upper, "string")))
+	}
+
+	// The value is matched literally, so regex metacharacters must not leak into the pattern
+	quoted := regexp.QuoteMeta(value)
 
 	switch pattern {
 	case "starts_with":
-		return fmt.Sprintf("regexp(%s, /^%s/)", mapping.DgraphField, cleanValue)
+		return newComparison("regexp", mapping.DgraphField, regexLiteral("^"+quoted))
 	case "ends_with":
-		return fmt.Sprintf("regexp(%s, /%s$/)", mapping.DgraphField, cleanValue)
+		return newComparison("regexp", mapping.DgraphField, regexLiteral(quoted+"$"))
 	default:
-		return ""
+		return nil
 	}
 }
 
-func (c *Converter) formatValue(value interface{}, dataType string) string {
+// rawValue returns the canonical text of a filter value for the given data
+// type, ready to be passed as a query variable
+func (c *Converter) rawValue(value interface{}, dataType string) (string, bool) {
 	if value == nil {
-		return ""
+		return "", false
 	}
 
 	switch dataType {
-	case "string":
-		if str, ok := value.(string); ok {
-			return fmt.Sprintf(`"%s"`, strings.ReplaceAll(str, `"`, `\"`))
-		}
-		return fmt.Sprintf(`"%v"`, value)
-
 	case "int":
 		switch v := value.(type) {
 		case int:
-			return strconv.Itoa(v)
+			return strconv.Itoa(v), true
 		case float64:
-			return strconv.Itoa(int(v))
+			return strconv.Itoa(int(v)), true
 		case string:
 			if i, err := strconv.Atoi(v); err == nil {
-				return strconv.Itoa(i)
+				return strconv.Itoa(i), true
 			}
 		}
-		return fmt.Sprintf("%v", value)
+		return "", false
 
 	case "float":
 		switch v := value.(type) {
 		case float64:
-			return strconv.FormatFloat(v, 'f', -1, 64)
+			return strconv.FormatFloat(v, 'f', -1, 64), true
 		case int:
-			return strconv.FormatFloat(float64(v), 'f', -1, 64)
+			return strconv.FormatFloat(float64(v), 'f', -1, 64), true
 		case string:
 			if f, err := strconv.ParseFloat(v, 64); err == nil {
-				return strconv.FormatFloat(f, 'f', -1, 64)
+				return strconv.FormatFloat(f, 'f', -1, 64), true
 			}
 		}
-		return fmt.Sprintf("%v", value)
+		return "", false
 
 	case "bool":
 		if b, ok := value.(bool); ok {
-			return strconv.FormatBool(b)
+			return strconv.FormatBool(b), true
 		}
-		return "false"
+		return "", false
 
 	case "datetime":
+		if expr, ok := relativeDateExpression(value); ok {
+			resolved, err := utils.ResolveRelativeDate(expr, c.now().UTC())
+			if err != nil {
+				return "", false
+			}
+			return resolved.Format(time.RFC3339), true
+		}
 
 		if str, ok := value.(string); ok {
-			return fmt.Sprintf(`"%s"`, str)
+			return str, true
 		}
-		return fmt.Sprintf(`"%v"`, value)
+		return "", false
 
 	default:
-		return fmt.Sprintf(`"%v"`, value)
-	}
-}
-
-func (c *Converter) buildVersionComparisonCondition(mapping *models.FieldMapping, filter models.Filter, dqlFunction string) string {
-	versionStr, ok := filter.Value.(string)
-	if !ok {
-		value := c.formatValue(filter.Value, mapping.DataType)
-		return fmt.Sprintf("%s(%s, %s)", dqlFunction, mapping.DgraphField, value)
-	}
-
-	numericVersion, err := utils.ConvertVersionToNumeric(versionStr)
-	if err != nil {
-		value := c.formatValue(filter.Value, mapping.DataType)
-		return fmt.Sprintf("%s(%s, %s)", dqlFunction, mapping.DgraphField, value)
+		switch value.(type) {
+		case []interface{}, map[string]interface{}:
+			return "", false
+		}
+		return fmt.Sprintf("%v", value), true
 	}
-
-	numericField := mapping.DgraphField + "_numeric"
-	return fmt.Sprintf("%s(%s, %d)", dqlFunction, numericField, numericVersion)
 }
 
-func (c *Converter) buildComplexObjectCondition(mapping *models.FieldMapping, obj map[string]interface{}) string {
+func (c *Converter) buildComplexObjectCondition(params *queryParams, mapping *models.FieldMapping, obj map[string]interface{}) Expr {
 	if mapping.JSONField == "watched_content" {
 		if contentType, exists := obj["content_type"]; exists {
 			if ids, idsExist := obj["ids"]; idsExist {
 				if idArray, ok := ids.([]interface{}); ok {
-					var conditions []string
+					var conditions []Expr
 
 					if ctMappings, ctExists := c.schema.FieldMappings["content_type"]; ctExists {
 						for _, ctMapping := range ctMappings {
 							if ctMapping.EntityType == mapping.EntityType {
-								typeValue := c.formatValue(contentType, "string")
-								conditions = append(conditions, fmt.Sprintf("eq(%s, %s)", ctMapping.DgraphField, typeValue))
+								typeValue := c.bindValue(params, contentType, "string")
+								conditions = append(conditions, newComparison("eq", ctMapping.DgraphField, typeValue))
 								break
 							}
 						}
 					}
 
-					var idConditions []string
+					var idConditions []Expr
 					for _, id := range idArray {
 						var idValue string
 						switch v := id.(type) {
-						case int:
-							idValue = fmt.Sprintf(`"%d"`, v)
-						case int64:
-							idValue = fmt.Sprintf(`"%d"`, v)
 						case float64:
-							idValue = fmt.Sprintf(`"%.0f"`, v)
-						case string:
-							idValue = fmt.Sprintf(`"%s"`, v)
+							idValue = params.bind(fmt.Sprintf("%.0f", v), "string")
 						default:
-							idValue = c.formatValue(id, "string")
+							idValue = c.bindValue(params, id, "string")
 						}
 
 						if idValue != "" {
-							idConditions = append(idConditions, fmt.Sprintf("eq(%s, %s)", mapping.DgraphField, idValue))
+							idConditions = append(idConditions, newComparison("eq", mapping.DgraphField, idValue))
 						}
 					}
 
-					if len(idConditions) > 1 {
-						conditions = append(conditions, "("+strings.Join(idConditions, " OR ")+")")
-					} else if len(idConditions) == 1 {
-						conditions = append(conditions, idConditions[0])
+					if len(idConditions) > 0 {
+						conditions = append(conditions, newOr(idConditions...))
 					}
 
 					if len(conditions) > 0 {
-						return "(" + strings.Join(conditions, " AND ") + ")"
+						return &BoolOp{Op: "AND", Operands: conditions}
 					}
 				}
 			}
 		}
 	}
 
-	return ""
+	return nil
+}
+
+// renderVarBlock renders a var block of the query text
+func renderVarBlock(variable models.VariableBlock) string {
+	directives := ""
+	if variable.Filter != "" {
+		directives += " " + variable.Filter
+	}
+	if variable.Cascade {
+		directives += " @cascade"
+	}
+
+	// Unnamed blocks only define value variables inside their fields
+	binding := ""
+	if variable.Name != "" {
+		binding = variable.Name + " as "
+	}
+
+	return fmt.Sprintf("  %svar(func: type(%s))%s {\n%s\n  }",
+		binding,
+		variable.Type,
+		directives,
+		variable.Fields,
+	)
 }
 
 func (c *Converter) GenerateDQLString(dqlQuery *models.DQLQuery) string {
 	var blocks []string
 
 	for _, variable := range dqlQuery.Variables {
-		var block string
-		if variable.Filter != "" {
-			block = fmt.Sprintf("  %s as var(func: type(%s)) %s {\n%s\n  }",
-				variable.Name,
-				variable.Type,
-				variable.Filter,
-				variable.Fields,
-			)
-		} else {
-			block = fmt.Sprintf("  %s as var(func: type(%s)) {\n%s\n  }",
-				variable.Name,
-				variable.Type,
-				variable.Fields,
-			)
-		}
-		blocks = append(blocks, block)
+		blocks = append(blocks, renderVarBlock(variable))
+	}
+
+	arguments := []string{"func: " + dqlQuery.MainQuery.Function}
+	if dqlQuery.MainQuery.Ordering != "" {
+		arguments = append(arguments, dqlQuery.MainQuery.Ordering)
+	}
+	if dqlQuery.MainQuery.Pagination != "" {
+		arguments = append(arguments, dqlQuery.MainQuery.Pagination)
 	}
 
-	mainBlock := fmt.Sprintf("  %s(func: %s, %s) %s {\n%s\n  }",
+	mainBlock := fmt.Sprintf("  %s(%s) %s {\n%s\n  }",
 		dqlQuery.MainQuery.Name,
-		dqlQuery.MainQuery.Function,
-		dqlQuery.MainQuery.Pagination,
+		strings.Join(arguments, ", "),
 		dqlQuery.MainQuery.Filter,
 		dqlQuery.MainQuery.Fields,
 	)
 	blocks = append(blocks, mainBlock)
 
-	return "query {\n" + strings.Join(blocks, "\n") + "\n}"
+	header := "query"
+	if len(dqlQuery.Params) > 0 {
+		var declarations []string
+		for _, param := range dqlQuery.Params {
+			declarations = append(declarations, fmt.Sprintf("%s: %s", param.Name, param.Type))
+		}
+		header = fmt.Sprintf("query segment(%s)", strings.Join(declarations, ", "))
+	}
+
+	return header + " {\n" + strings.Join(blocks, "\n") + "\n}"
+}
+
+// relativeDateExpression returns the relative expression held by a datetime
+// value, given either as a string such as "now-30d" or as {"relative": "-7d"}
+func relativeDateExpression(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		if utils.IsRelativeDate(v) {
+			return v, true
+		}
+	case map[string]interface{}:
+		if expr, ok := v["relative"].(string); ok && len(v) == 1 {
+			return expr, true
+		}
+	}
+	return "", false
 }
@@ -0,0 +1,280 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+
+	models "github.com/shahariaz/user_segmentation/internal/model"
+)
+
+// cardinalityBlock names the block of the count queries run for each var block
+const cardinalityBlock = "cardinality"
+
+// Explanation describes how a JSON query compiles to DQL
+type Explanation struct {
+	TargetEntity string                `json:"target_entity"`
+	Root         string                `json:"root"`           // root function of the main block
+	Tree         *ExplainNode          `json:"tree,omitempty"` // normalized main filter
+	Filters      []FilterResolution    `json:"filters"`
+	VarBlocks    []ExplainedVarBlock   `json:"var_blocks"`
+	DQL          string                `json:"dql"`
+	DQLVars      map[string]string     `json:"dql_vars"`
+	Warnings     []models.QueryWarning `json:"warnings,omitempty"`
+
+	// Count is the size of the whole segment, set once CountQuery has run
+	Count      *int             `json:"count,omitempty"`
+	CountQuery *models.DQLQuery `json:"-"`
+}
+
+// ExplainNode is a node of the normalized filter tree with the values bound
+// to its query variables
+type ExplainNode struct {
+	Op        string         `json:"op"` // AND, OR, NOT, uid or the DQL function of a comparison
+	Predicate string         `json:"predicate,omitempty"`
+	ValueVar  string         `json:"value_var,omitempty"`
+	Var       string         `json:"var,omitempty"` // var block matched by uid
+	Values    []string       `json:"values,omitempty"`
+	DQL       string         `json:"dql"`
+	Operands  []*ExplainNode `json:"operands,omitempty"`
+}
+
+// FilterResolution records the field mapping and entity a filter resolved to
+type FilterResolution struct {
+	Path    string               `json:"path"`
+	Field   string               `json:"field,omitempty"`
+	Op      string               `json:"op"`
+	Entity  string               `json:"entity,omitempty"`
+	Edges   []string             `json:"edges,omitempty"` // predicates leading from the target entity to Entity
+	Mapping *models.FieldMapping `json:"mapping,omitempty"`
+}
+
+// ExplainedVarBlock is a generated var block and the number of target
+// entities it matches, set once CountQuery has run. An aggregate block
+// matches the entities passing the comparisons on its value. When Excluded is
+// set the main filter negates the block, as for HAS_NONE or a negated group,
+// and Cardinality is the size of the set removed from the segment.
+type ExplainedVarBlock struct {
+	Var         string           `json:"var"`
+	Kind        string           `json:"kind"` // "traversal" or "aggregate"
+	DQL         string           `json:"dql"`
+	Excluded    bool             `json:"excluded"`
+	Cardinality *int             `json:"cardinality,omitempty"`
+	CountError  string           `json:"count_error,omitempty"`
+	CountQuery  *models.DQLQuery `json:"-"`
+}
+
+// Explain compiles a JSON query and describes the result: the normalized
+// filter tree, how each filter resolved, the var blocks and the root
+// function. It also prepares the count queries measuring the segment and
+// each var block, which the caller runs against Dgraph.
+func (c *Converter) Explain(jsonQuery *models.JSONQuery) (*Explanation, error) {
+	query, err := c.BuildQuery(jsonQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	countQuery, err := c.ConvertToCountDQL(jsonQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	dqlQuery := Print(query)
+	values := paramValues(query.Params)
+
+	explanation := &Explanation{
+		TargetEntity: query.Type,
+		Root:         PrintExpr(query.Root),
+		Tree:         explainExpr(query.Filter, values),
+		Filters:      c.resolveFilters(jsonQuery, query.Type),
+		DQL:          c.GenerateDQLString(dqlQuery),
+		DQLVars:      c.GenerateDQLVariables(dqlQuery),
+		Warnings:     query.Warnings,
+		CountQuery:   countQuery,
+	}
+
+	for i, block := range query.Vars {
+		name, kind := block.Name, "traversal"
+		if block.Aggregate != nil {
+			name, kind = block.Aggregate.Var, "aggregate"
+		}
+
+		explanation.VarBlocks = append(explanation.VarBlocks, ExplainedVarBlock{
+			Var:        name,
+			Kind:       kind,
+			DQL:        strings.TrimSpace(renderVarBlock(dqlQuery.Variables[i])),
+			Excluded:   negatesVar(query.Filter, name, false),
+			CountQuery: cardinalityQuery(query, block, name),
+		})
+	}
+
+	return explanation, nil
+}
+
+// cardinalityQuery counts the target entities a single var block matches.
+// Traversal blocks match the entities they collect. Aggregate blocks assign
+// a value to every entity, so they match those passing the comparisons the
+// main filter makes on it, or every entity with a value when it makes none,
+// as for blocks that only order the results.
+func cardinalityQuery(query *Query, block VarBlock, name string) *models.DQLQuery {
+	count := &Query{
+		Vars:      []VarBlock{block},
+		Name:      cardinalityBlock,
+		Type:      query.Type,
+		Root:      &VarRef{Name: name},
+		Selection: Selection{Count: true},
+		Params:    query.Params,
+	}
+	if block.Aggregate != nil {
+		if filter := valueComparisons(query.Filter, name); filter != nil {
+			count.Root = newComparison("type", "", query.Type)
+			count.Filter = filter
+		}
+	}
+	dropUnusedParams(count)
+	return Print(count)
+}
+
+// valueComparisons keeps the comparisons of an expression on a value
+// variable, with the AND and OR operators joining them. Negations are
+// dropped since the var block is reported as excluded instead.
+func valueComparisons(expr Expr, name string) Expr {
+	switch e := expr.(type) {
+	case *Comparison:
+		if e.ValueVar == name {
+			return e
+		}
+
+	case *Not:
+		return valueComparisons(e.Operand, name)
+
+	case *BoolOp:
+		var operands []Expr
+		for _, operand := range e.Operands {
+			if kept := valueComparisons(operand, name); kept != nil {
+				operands = append(operands, kept)
+			}
+		}
+		return newBoolOp(e.Op, operands)
+	}
+	return nil
+}
+
+// negatesVar reports whether an expression uses a var block under a NOT, so
+// the block's matches are removed from the result
+func negatesVar(expr Expr, name string, negated bool) bool {
+	switch e := expr.(type) {
+	case *VarRef:
+		return negated && e.Name == name
+	case *Comparison:
+		return negated && e.ValueVar == name
+	case *Not:
+		return negatesVar(e.Operand, name, !negated)
+	case *BoolOp:
+		for _, operand := range e.Operands {
+			if negatesVar(operand, name, negated) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// explainExpr converts a filter condition into its explain tree
+func explainExpr(expr Expr, values map[string]models.QueryParam) *ExplainNode {
+	if expr == nil {
+		return nil
+	}
+
+	node := &ExplainNode{DQL: PrintExpr(expr)}
+	switch e := expr.(type) {
+	case *Comparison:
+		node.Op = e.Func
+		node.Predicate = e.Predicate
+		node.ValueVar = e.ValueVar
+		for _, arg := range e.Args {
+			if param, ok := values[arg]; ok {
+				arg = param.Value
+			}
+			node.Values = append(node.Values, arg)
+		}
+
+	case *VarRef:
+		node.Op = "uid"
+		node.Var = e.Name
+
+	case *Not:
+		node.Op = "NOT"
+		node.Operands = []*ExplainNode{explainExpr(e.Operand, values)}
+
+	case *BoolOp:
+		node.Op = e.Op
+		for _, operand := range e.Operands {
+			node.Operands = append(node.Operands, explainExpr(operand, values))
+		}
+	}
+
+	return node
+}
+
+// resolveFilters lists the mapping and entity every filter of a query
+// resolves to, including the filters of macros and where groups
+func (c *Converter) resolveFilters(jsonQuery *models.JSONQuery, mainEntityType string) []FilterResolution {
+	var resolutions []FilterResolution
+	for i, group := range jsonQuery.Groups {
+		c.resolveGroupFilters(group, mainEntityType, "", fmt.Sprintf("groups[%d]", i), &resolutions)
+	}
+	return resolutions
+}
+
+// resolveGroupFilters resolves the filters of a group evaluated on the scope
+// entity, or on the main entity when scope is ""
+func (c *Converter) resolveGroupFilters(group models.Group, mainEntityType, scope, path string, resolutions *[]FilterResolution) {
+	if group.Macro != "" {
+		expanded, ok := c.expandGroupMacro(group, path, &ValidationError{})
+		if !ok {
+			return
+		}
+		group, path = expanded, path+".macro"
+	}
+	if group.Scope != "" {
+		scope = group.Scope
+	}
+
+	for i, filter := range group.Filters {
+		filterPath := fmt.Sprintf("%s.filters[%d]", path, i)
+		if filter.Macro != "" {
+			if expanded, ok := c.expandFilterMacro(filter, filterPath, &ValidationError{}); ok {
+				c.resolveGroupFilters(expanded, mainEntityType, scope, filterPath+".macro", resolutions)
+			}
+			continue
+		}
+
+		resolution := FilterResolution{Path: filterPath, Field: filter.Field, Op: filter.Op}
+		switch {
+		case filter.Aggregate != "" || filter.Op == "HAS_NONE":
+			resolution.Entity = filter.Relationship
+			resolution.Edges = c.relationshipPath(mainEntityType, filter.Relationship)
+			if filter.Field != "" {
+				resolution.Mapping = c.relationshipFieldMapping(filter.Field, filter.Relationship)
+			}
+		case scope != "":
+			resolution.Entity = scope
+			resolution.Edges = c.relationshipPath(mainEntityType, scope)
+			resolution.Mapping = c.relationshipFieldMapping(filter.Field, scope)
+		default:
+			resolution.Mapping, resolution.Edges = c.resolveMapping(c.schema.FieldMappings[filter.Field], mainEntityType)
+			if resolution.Mapping != nil {
+				resolution.Entity = resolution.Mapping.EntityType
+			}
+		}
+		*resolutions = append(*resolutions, resolution)
+
+		if filter.Where != nil {
+			c.resolveGroupFilters(*filter.Where, mainEntityType, filter.Relationship, filterPath+".where", resolutions)
+		}
+	}
+
+	for i, nestedGroup := range group.Groups {
+		c.resolveGroupFilters(nestedGroup, mainEntityType, scope, fmt.Sprintf("%s.groups[%d]", path, i), resolutions)
+	}
+}
@@ -0,0 +1,70 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExplainVarBlocks(t *testing.T) {
+	tests := []struct {
+		name     string
+		group    string
+		excluded bool
+		count    string // main block of the cardinality query
+	}{
+		{
+			name:  "aggregate comparison",
+			group: `{"combine_with":"AND","filters":[{"aggregate":"count","relationship":"devices","op":">=","value":3}]}`,
+			count: "cardinality(func: type(customers)) @filter(ge(val(var0), $v0))",
+		},
+		{
+			name:  "aggregate range",
+			group: `{"combine_with":"AND","filters":[{"field":"country","op":"=","value":"US"},{"aggregate":"count","relationship":"devices","op":"BETWEEN","value":[2,4]}]}`,
+			count: "cardinality(func: type(customers)) @filter(ge(val(var0), $v1) AND le(val(var0), $v2))",
+		},
+		{
+			name:     "negated aggregate",
+			group:    `{"combine_with":"AND","negate":true,"filters":[{"aggregate":"count","relationship":"devices","op":">=","value":3}]}`,
+			excluded: true,
+			count:    "cardinality(func: type(customers)) @filter(ge(val(var0), $v0))",
+		},
+		{
+			name:  "traversal",
+			group: `{"combine_with":"AND","filters":[{"field":"purchase_amount","op":">","value":50}]}`,
+			count: "cardinality(func: uid(var0))",
+		},
+		{
+			name:     "has none",
+			group:    `{"combine_with":"AND","filters":[{"op":"HAS_NONE","relationship":"purchases","where":{"combine_with":"AND","filters":[{"field":"purchase_amount","op":">","value":50}]}}]}`,
+			excluded: true,
+			count:    "cardinality(func: uid(var0))",
+		},
+		{
+			name:     "negated group",
+			group:    `{"combine_with":"OR","negate":true,"filters":[{"field":"purchase_amount","op":">","value":50},{"field":"country","op":"=","value":"US"}]}`,
+			excluded: true,
+			count:    "cardinality(func: uid(var0))",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConverter()
+			explanation, err := c.Explain(parseQuery(t, `{"combine_with":"AND","groups":[`+tt.group+`]}`))
+			if err != nil {
+				t.Fatalf("Explain: %v", err)
+			}
+			if len(explanation.VarBlocks) != 1 {
+				t.Fatalf("got %d var blocks, want 1", len(explanation.VarBlocks))
+			}
+
+			block := explanation.VarBlocks[0]
+			if block.Excluded != tt.excluded {
+				t.Errorf("excluded = %v, want %v", block.Excluded, tt.excluded)
+			}
+			if dql := c.GenerateDQLString(block.CountQuery); !strings.Contains(dql, tt.count) {
+				t.Errorf("cardinality query does not contain %q:\n%s", tt.count, dql)
+			}
+		})
+	}
+}
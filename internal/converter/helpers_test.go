@@ -0,0 +1,97 @@
+package converter
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	models "github.com/shahariaz/user_segmentation/internal/model"
+)
+
+// parseQuery decodes a JSON query and fails the test when it is malformed
+func parseQuery(t *testing.T, query string) *models.JSONQuery {
+	t.Helper()
+
+	var jsonQuery models.JSONQuery
+	if err := json.Unmarshal([]byte(query), &jsonQuery); err != nil {
+		t.Fatalf("invalid test query: %v", err)
+	}
+	return &jsonQuery
+}
+
+// buildQuery compiles a JSON query with the default converter and fails the
+// test when it does not convert
+func buildQuery(t *testing.T, query string) *Query {
+	t.Helper()
+	return buildQueryWith(t, NewConverter(), query)
+}
+
+// buildQueryWith compiles a JSON query with the given converter
+func buildQueryWith(t *testing.T, c *Converter, query string) *Query {
+	t.Helper()
+
+	built, err := c.BuildQuery(parseQuery(t, query))
+	if err != nil {
+		t.Fatalf("BuildQuery: %v", err)
+	}
+	return built
+}
+
+// validationIssues compiles a JSON query that is expected to be rejected and
+// returns the issues reported
+func validationIssues(t *testing.T, query string) []ValidationIssue {
+	t.Helper()
+	return validationIssuesWith(t, NewConverter(), query)
+}
+
+// validationIssuesWith compiles a JSON query that is expected to be rejected
+// with the given converter
+func validationIssuesWith(t *testing.T, c *Converter, query string) []ValidationIssue {
+	t.Helper()
+
+	_, err := c.BuildQuery(parseQuery(t, query))
+	validationErr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("BuildQuery error = %v, want a validation error", err)
+	}
+	return validationErr.Issues
+}
+
+// conditions returns the conjuncts of a query's root function and filter
+// other than type(), with their query variables replaced by quoted values
+func conditions(query *Query) []string {
+	var rendered []string
+	for _, expr := range append(flattenAnd(query.Root), flattenAnd(query.Filter)...) {
+		if comparison, ok := expr.(*Comparison); ok && comparison.Func == "type" {
+			continue
+		}
+		if expr != nil {
+			rendered = append(rendered, renderWithValues(expr, query.Params))
+		}
+	}
+	return rendered
+}
+
+// traversals returns the edges and filter of each named var block of a query
+func traversals(query *Query) map[string]string {
+	rendered := make(map[string]string)
+	for _, block := range query.Vars {
+		if block.Traversal != nil {
+			rendered[block.Name] = strings.Join(block.Traversal.Edges, "/") + " " +
+				renderWithValues(block.Traversal.Filter, query.Params)
+		}
+	}
+	return rendered
+}
+
+// renderWithValues prints an expression with its query variables replaced by
+// their quoted values
+func renderWithValues(expr Expr, params []models.QueryParam) string {
+	text := PrintExpr(expr)
+	// Replace $v10 before $v1
+	for i := len(params) - 1; i >= 0; i-- {
+		text = strings.ReplaceAll(text, params[i].Name, strconv.Quote(params[i].Value))
+	}
+	return text
+}
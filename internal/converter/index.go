@@ -0,0 +1,131 @@
+package converter
+
+import (
+	"fmt"
+	"slices"
+	"unicode/utf8"
+
+	models "github.com/shahariaz/user_segmentation/internal/model"
+)
+
+// WithPredicateSchema sets the predicate indexes the converter checks
+// operators against, such as those introspected from a running Dgraph
+// instead of the bundled schema
+func WithPredicateSchema(predicates map[string]models.PredicateSchema) Option {
+	return func(c *Converter) {
+		c.predicates = predicates
+	}
+}
+
+// checkIndexSupport reports filters whose generated function needs an index
+// the predicate does not have. Dgraph answers eq and the inequality functions
+// inside @filter without an index, but the text and regular expression
+// functions always look up their tokenizer's index.
+func (c *Converter) checkIndexSupport(mapping *models.FieldMapping, filter models.Filter, path string, report *ValidationError) bool {
+	switch filter.Op {
+	case "LIKE", "ILIKE":
+		return c.checkLikeIndex(mapping, filter, path, report)
+
+	case "CONTAINS":
+		if c.textFunction(mapping.DgraphField) != "" {
+			return true
+		}
+		suggestion := `use "=" or "IN" to match whole values`
+		if c.hasIndex(mapping.DgraphField, "trigram") {
+			suggestion = `use "LIKE" with % wildcards to match part of the value`
+		}
+		report.add(path+".op", CodeUnsupportedOperand,
+			fmt.Sprintf("CONTAINS needs a fulltext or term index on %s", mapping.DgraphField), suggestion)
+		return false
+
+	case "REGEX", "ENDS_WITH":
+		if !c.hasIndex(mapping.DgraphField, "trigram") {
+			report.add(path+".op", CodeUnsupportedOperand,
+				fmt.Sprintf("%s needs a trigram index on %s", filter.Op, mapping.DgraphField),
+				`use "=", "IN" or "STARTS_WITH"`)
+			return false
+		}
+		if suffix, _ := filter.Value.(string); filter.Op == "ENDS_WITH" && utf8.RuneCountInString(suffix) < minTrigramLiteral {
+			report.add(path+".value", CodeInvalidValue,
+				fmt.Sprintf("suffix %q needs at least %d characters", suffix, minTrigramLiteral),
+				"make the suffix more specific")
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkLikeIndex requires a trigram index for LIKE patterns compiled to
+// regexp, which are all but case-sensitive patterns without wildcards
+func (c *Converter) checkLikeIndex(mapping *models.FieldMapping, filter models.Filter, path string, report *ValidationError) bool {
+	pattern, _ := filter.Value.(string)
+	parsed := parseLikePattern(pattern)
+	if filter.Op == "LIKE" && !parsed.hasWildcards {
+		return true
+	}
+
+	if !c.hasIndex(mapping.DgraphField, "trigram") {
+		report.add(path+".op", CodeUnsupportedOperand,
+			fmt.Sprintf("%s with wildcards or case folding needs a trigram index on %s", filter.Op, mapping.DgraphField),
+			`use "=" for exact matches or "CONTAINS" for word matches`)
+		return false
+	}
+
+	if parsed.longestLiteral < minTrigramLiteral {
+		report.add(path+".value", CodeInvalidValue,
+			fmt.Sprintf("pattern %q needs at least %d consecutive literal characters", pattern, minTrigramLiteral),
+			"make the pattern more specific")
+		return false
+	}
+
+	return true
+}
+
+// textFunction returns the function CONTAINS compiles to on a predicate:
+// alloftext with a fulltext index, which also matches other forms of a word,
+// allofterms with only a term index, or "" when neither is available
+func (c *Converter) textFunction(predicate string) string {
+	switch {
+	case c.hasIndex(predicate, "fulltext"):
+		return "alloftext"
+	case c.hasIndex(predicate, "term"):
+		return "allofterms"
+	}
+	return ""
+}
+
+// usePrefixRange reports whether STARTS_WITH compiles to a range of strings
+// rather than an anchored regexp. A range is answered by an exact index and
+// needs no index at all inside @filter, while regexp needs a trigram index
+// and a prefix of at least three characters.
+func (c *Converter) usePrefixRange(predicate, prefix string) bool {
+	if c.hasIndex(predicate, "exact") || !c.hasIndex(predicate, "trigram") {
+		return true
+	}
+	return utf8.RuneCountInString(prefix) < minTrigramLiteral
+}
+
+// prefixUpperBound returns the smallest string greater than every string
+// starting with prefix, or false when there is none
+func prefixUpperBound(prefix string) (string, bool) {
+	runes := []rune(prefix)
+	for len(runes) > 0 {
+		last := len(runes) - 1
+		if next := runes[last] + 1; next <= utf8.MaxRune {
+			if next >= 0xD800 && next <= 0xDFFF {
+				// Surrogates are not valid runes
+				next = 0xE000
+			}
+			runes[last] = next
+			return string(runes), true
+		}
+		runes = runes[:last]
+	}
+	return "", false
+}
+
+// hasIndex reports whether a predicate has the given index tokenizer
+func (c *Converter) hasIndex(predicate, tokenizer string) bool {
+	return slices.Contains(c.predicates[predicate].Indexes, tokenizer)
+}
@@ -0,0 +1,81 @@
+package converter
+
+import (
+	"regexp"
+	"strings"
+
+	models "github.com/shahariaz/user_segmentation/internal/model"
+)
+
+// minTrigramLiteral is the shortest literal run Dgraph can look up in a
+// trigram index; patterns without one are rejected as too wide-ranging
+const minTrigramLiteral = 3
+
+// likePattern is a SQL LIKE pattern translated for Dgraph
+type likePattern struct {
+	regex          string // anchored regular expression
+	literal        string // unescaped text when the pattern has no wildcards
+	hasWildcards   bool
+	longestLiteral int
+}
+
+// parseLikePattern translates % and _ into .* and . and quotes everything else.
+// A backslash makes the next character literal, so \% matches a percent sign.
+func parseLikePattern(pattern string) likePattern {
+	var regex, literal, run strings.Builder
+	parsed := likePattern{}
+
+	flushRun := func() {
+		parsed.longestLiteral = max(parsed.longestLiteral, len([]rune(run.String())))
+		regex.WriteString(regexp.QuoteMeta(run.String()))
+		run.Reset()
+	}
+
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && i+1 < len(runes):
+			i++
+			run.WriteRune(runes[i])
+			literal.WriteRune(runes[i])
+		case r == '%':
+			flushRun()
+			regex.WriteString(".*")
+			parsed.hasWildcards = true
+		case r == '_':
+			flushRun()
+			regex.WriteString(".")
+			parsed.hasWildcards = true
+		default:
+			run.WriteRune(r)
+			literal.WriteRune(r)
+		}
+	}
+	flushRun()
+
+	parsed.regex = "^" + regex.String() + "$"
+	parsed.literal = literal.String()
+	return parsed
+}
+
+// buildLikeCondition compiles LIKE and ILIKE with SQL wildcard semantics. A
+// case-sensitive pattern without wildcards is an exact match and uses eq; any
+// other pattern becomes an anchored regexp, case-insensitive for ILIKE.
+func (c *Converter) buildLikeCondition(params *queryParams, mapping *models.FieldMapping, filter models.Filter) Expr {
+	pattern, ok := filter.Value.(string)
+	if !ok || pattern == "" {
+		return nil
+	}
+
+	parsed := parseLikePattern(pattern)
+	if filter.Op == "LIKE" && !parsed.hasWildcards {
+		return newComparison("eq", mapping.DgraphField, params.bind(parsed.literal, "string"))
+	}
+
+	flags := ""
+	if filter.Op == "ILIKE" {
+		flags = "i"
+	}
+	return newComparison("regexp", mapping.DgraphField, regexLiteral(parsed.regex)+flags)
+}
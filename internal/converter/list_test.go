@@ -0,0 +1,113 @@
+package converter
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestListOperators(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		field      string
+		op         string
+		conditions []string
+		traversals map[string]string
+	}{
+		{
+			name:       "any on the target entity",
+			target:     "watch_histories",
+			field:      "favorite_genres",
+			op:         "CONTAINS_ANY",
+			conditions: []string{`eq(watch_histories.genre, ["Action", "Comedy"])`},
+			traversals: map[string]string{},
+		},
+		{
+			name:       "all on the target entity",
+			target:     "watch_histories",
+			field:      "favorite_genres",
+			op:         "CONTAINS_ALL",
+			conditions: []string{`eq(watch_histories.genre, "Action")`, `eq(watch_histories.genre, "Comedy")`},
+			traversals: map[string]string{},
+		},
+		{
+			name:       "none on the target entity",
+			target:     "watch_histories",
+			field:      "favorite_genres",
+			op:         "CONTAINS_NONE",
+			conditions: []string{`NOT eq(watch_histories.genre, ["Action", "Comedy"])`},
+			traversals: map[string]string{},
+		},
+		{
+			name:       "any on a related entity",
+			target:     "customers",
+			field:      "genre",
+			op:         "CONTAINS_ANY",
+			conditions: []string{"uid(var0)"},
+			traversals: map[string]string{
+				"var0": `customers.watch_histories/watch_histories.content eq(contents.genre, ["Action", "Comedy"])`,
+			},
+		},
+		{
+			// Each value may be held by a different related record
+			name:       "all on a related entity",
+			target:     "customers",
+			field:      "genre",
+			op:         "CONTAINS_ALL",
+			conditions: []string{"uid(var0)", "uid(var1)"},
+			traversals: map[string]string{
+				"var0": `customers.watch_histories/watch_histories.content eq(contents.genre, "Action")`,
+				"var1": `customers.watch_histories/watch_histories.content eq(contents.genre, "Comedy")`,
+			},
+		},
+		{
+			// No related record may hold any of the values
+			name:       "none on a related entity",
+			target:     "customers",
+			field:      "genre",
+			op:         "CONTAINS_NONE",
+			conditions: []string{"NOT uid(var0)"},
+			traversals: map[string]string{
+				"var0": `customers.watch_histories/watch_histories.content eq(contents.genre, ["Action", "Comedy"])`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := buildQuery(t, fmt.Sprintf(`{
+				"combine_with": "AND",
+				"target_entity": %q,
+				"groups": [{"combine_with": "AND", "filters": [
+					{"field": %q, "op": %q, "value": ["Action", "Comedy"]}
+				]}]
+			}`, tt.target, tt.field, tt.op))
+
+			if got := conditions(query); !reflect.DeepEqual(got, tt.conditions) {
+				t.Errorf("conditions = %q, want %q", got, tt.conditions)
+			}
+			if got := traversals(query); !reflect.DeepEqual(got, tt.traversals) {
+				t.Errorf("var blocks = %q, want %q", got, tt.traversals)
+			}
+		})
+	}
+}
+
+func TestListOperatorsInScopedGroup(t *testing.T) {
+	// Within a scope every condition holds on the same related record
+	query := buildQuery(t, `{
+		"combine_with": "AND",
+		"groups": [{"combine_with": "AND", "scope": "watch_histories", "filters": [
+			{"field": "favorite_genres", "op": "CONTAINS_ALL", "value": ["Action", "Comedy"]},
+			{"field": "favorite_genres", "op": "CONTAINS_NONE", "value": ["Horror"]}
+		]}]
+	}`)
+
+	want := map[string]string{
+		"var0": `customers.watch_histories (eq(watch_histories.genre, "Action") AND eq(watch_histories.genre, "Comedy") AND NOT eq(watch_histories.genre, "Horror"))`,
+	}
+	if got := traversals(query); !reflect.DeepEqual(got, want) {
+		t.Errorf("var blocks = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,239 @@
+package converter
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	models "github.com/shahariaz/user_segmentation/internal/model"
+)
+
+// Warning codes reported in a QueryWarning
+const (
+	CodeUnsatisfiable = "unsatisfiable"
+	CodeTautology     = "tautology"
+)
+
+// fieldBound is one side of a range on a field
+type fieldBound struct {
+	value     string
+	inclusive bool
+	set       bool
+}
+
+// fieldConstraints collects the conditions a group places on one field
+type fieldConstraints struct {
+	dataType     string
+	lower, upper fieldBound
+	equals       []string
+	notEquals    []string
+	null         bool
+	notNull      bool
+}
+
+// checkLogic warns about groups that can never match or that match every
+// record with a value, such as age > 40 AND age < 20. Such groups are still
+// converted; they usually point at a mistake in the segment definition.
+func (c *Converter) checkLogic(jsonQuery *models.JSONQuery, mainEntityType string) []models.QueryWarning {
+	var warnings []models.QueryWarning
+	for i, group := range jsonQuery.Groups {
+		c.checkGroupLogic(group, mainEntityType, fmt.Sprintf("groups[%d]", i), &warnings)
+	}
+	return warnings
+}
+
+// checkGroupLogic checks the filters of a group on fields of the entity it is
+// evaluated on, then its nested groups. Filters on other entities are skipped
+// since each may be satisfied by a different related record.
+func (c *Converter) checkGroupLogic(group models.Group, entityType, path string, warnings *[]models.QueryWarning) {
+	if group.Macro != "" {
+		expanded, ok := c.expandGroupMacro(group, path, &ValidationError{})
+		if !ok {
+			return
+		}
+		group, path = expanded, path+".macro"
+	}
+	if group.Scope != "" {
+		entityType = group.Scope
+	}
+
+	or := strings.ToUpper(group.CombineWith) == "OR"
+	constraints := make(map[string]*fieldConstraints)
+	var fields []string
+
+	for _, filter := range group.Filters {
+		if filter.Aggregate != "" || filter.Macro != "" {
+			continue
+		}
+		mapping := c.relationshipFieldMapping(filter.Field, entityType)
+		if mapping == nil || c.predicates[mapping.DgraphField].List {
+			continue
+		}
+
+		constraint, exists := constraints[filter.Field]
+		if !exists {
+			dataType := mapping.DataType
+			if _, isVersion := c.versionFields[filter.Field]; isVersion {
+				dataType = "version"
+			}
+			constraint = &fieldConstraints{dataType: dataType}
+			constraints[filter.Field] = constraint
+			fields = append(fields, filter.Field)
+		}
+		c.addConstraint(constraint, filter, or)
+	}
+
+	for _, field := range fields {
+		var code, message string
+		switch {
+		case or && constraints[field].coversAll():
+			code, message = CodeTautology, fmt.Sprintf("conditions on %q match every record with a value", field)
+			if group.Negate {
+				code, message = CodeUnsatisfiable,
+					fmt.Sprintf("the group negates conditions on %q that match every record with a value, so it matches none", field)
+			}
+		case !or && constraints[field].contradicts():
+			code, message = CodeUnsatisfiable, fmt.Sprintf("conditions on %q can never hold together", field)
+			if group.Negate {
+				code, message = CodeTautology,
+					fmt.Sprintf("the group negates conditions on %q that can never hold together, so it matches every record", field)
+			}
+		default:
+			continue
+		}
+		*warnings = append(*warnings, models.QueryWarning{Path: path, Code: code, Message: message})
+	}
+
+	for i, nestedGroup := range group.Groups {
+		c.checkGroupLogic(nestedGroup, entityType, fmt.Sprintf("%s.groups[%d]", path, i), warnings)
+	}
+}
+
+// addConstraint records a filter on a field. Under AND the tightest bound of
+// each side is kept and under OR the loosest, which is what decides whether
+// the group contradicts itself or covers every value.
+func (c *Converter) addConstraint(constraint *fieldConstraints, filter models.Filter, or bool) {
+	raw := func(value interface{}) (string, bool) {
+		if constraint.dataType == "version" {
+			version, ok := value.(string)
+			return version, ok
+		}
+		return c.rawValue(value, constraint.dataType)
+	}
+	bound := func(current *fieldBound, value interface{}, inclusive, lower bool) {
+		v, ok := raw(value)
+		if !ok {
+			return
+		}
+		next := fieldBound{value: v, inclusive: inclusive, set: true}
+		if !current.set {
+			*current = next
+			return
+		}
+
+		order, ok := compareValues(next.value, current.value, constraint.dataType)
+		if !ok {
+			return
+		}
+		tighter := order > 0 || (order == 0 && !inclusive)
+		if !lower {
+			tighter = order < 0 || (order == 0 && !inclusive)
+		}
+		if tighter != or {
+			*current = next
+		}
+	}
+
+	switch filter.Op {
+	case "=":
+		if v, ok := raw(filter.Value); ok {
+			constraint.equals = append(constraint.equals, v)
+		}
+	case "!=":
+		if v, ok := raw(filter.Value); ok {
+			constraint.notEquals = append(constraint.notEquals, v)
+		}
+	case ">", ">=":
+		bound(&constraint.lower, filter.Value, filter.Op == ">=", true)
+	case "<", "<=":
+		bound(&constraint.upper, filter.Value, filter.Op == "<=", false)
+	case "BETWEEN":
+		// A closed interval neither bounds one side of an OR nor covers it
+		if low, high, ok := betweenOperands(filter.Value); ok && !or {
+			bound(&constraint.lower, low, true, true)
+			bound(&constraint.upper, high, true, false)
+		}
+	case "IS_NULL":
+		constraint.null = true
+	case "IS_NOT_NULL":
+		constraint.notNull = true
+	}
+}
+
+// contradicts reports whether the constraints, all required to hold, exclude
+// every value
+func (f *fieldConstraints) contradicts() bool {
+	hasValue := f.lower.set || f.upper.set || len(f.equals) > 0 || f.notNull
+	if f.null && hasValue {
+		return true
+	}
+
+	if f.lower.set && f.upper.set {
+		if order, ok := compareValues(f.lower.value, f.upper.value, f.dataType); ok {
+			if order > 0 || (order == 0 && !(f.lower.inclusive && f.upper.inclusive)) {
+				return true
+			}
+		}
+	}
+
+	for _, value := range f.equals {
+		if value != f.equals[0] || slices.Contains(f.notEquals, value) {
+			return true
+		}
+		if f.lower.set && !f.lower.admits(value, f.dataType, true) {
+			return true
+		}
+		if f.upper.set && !f.upper.admits(value, f.dataType, false) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// coversAll reports whether the constraints, any one sufficing, admit every
+// value, such as age > 30 OR age < 40
+func (f *fieldConstraints) coversAll() bool {
+	if f.null && f.notNull {
+		return true
+	}
+
+	for _, value := range f.equals {
+		if slices.Contains(f.notEquals, value) {
+			return true
+		}
+	}
+	if len(f.notEquals) > 1 && slices.ContainsFunc(f.notEquals, func(v string) bool { return v != f.notEquals[0] }) {
+		return true
+	}
+
+	if f.lower.set && f.upper.set {
+		if order, ok := compareValues(f.lower.value, f.upper.value, f.dataType); ok {
+			return order < 0 || (order == 0 && (f.lower.inclusive || f.upper.inclusive))
+		}
+	}
+
+	return false
+}
+
+// admits reports whether a value lies on the allowed side of a bound
+func (b fieldBound) admits(value, dataType string, lower bool) bool {
+	order, ok := compareValues(value, b.value, dataType)
+	if !ok {
+		return true
+	}
+	if order == 0 {
+		return b.inclusive
+	}
+	return (order > 0) == lower
+}
@@ -0,0 +1,134 @@
+package converter
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestLogicWarnings(t *testing.T) {
+	tests := []struct {
+		name  string
+		group string
+		want  []string
+	}{
+		{
+			name:  "disjoint range",
+			group: `{"combine_with":"AND","filters":[{"field":"age","op":">","value":40},{"field":"age","op":"<","value":20}]}`,
+			want:  []string{"groups[0] unsatisfiable"},
+		},
+		{
+			name:  "range excluding its only bound",
+			group: `{"combine_with":"AND","filters":[{"field":"age","op":">=","value":30},{"field":"age","op":"<","value":30}]}`,
+			want:  []string{"groups[0] unsatisfiable"},
+		},
+		{
+			name:  "range including its only bound",
+			group: `{"combine_with":"AND","filters":[{"field":"age","op":">=","value":30},{"field":"age","op":"<=","value":30}]}`,
+		},
+		{
+			// The tightest lower bound, > 30, rules out = 30
+			name:  "equality outside the tightest bound",
+			group: `{"combine_with":"AND","filters":[{"field":"age","op":">=","value":30},{"field":"age","op":">","value":30},{"field":"age","op":"=","value":30}]}`,
+			want:  []string{"groups[0] unsatisfiable"},
+		},
+		{
+			name:  "two equalities",
+			group: `{"combine_with":"AND","filters":[{"field":"country","op":"=","value":"US"},{"field":"country","op":"=","value":"CA"}]}`,
+			want:  []string{"groups[0] unsatisfiable"},
+		},
+		{
+			name:  "equality and inequality",
+			group: `{"combine_with":"AND","filters":[{"field":"country","op":"=","value":"US"},{"field":"country","op":"!=","value":"US"}]}`,
+			want:  []string{"groups[0] unsatisfiable"},
+		},
+		{
+			name:  "null with a value",
+			group: `{"combine_with":"AND","filters":[{"field":"age","op":"IS_NULL"},{"field":"age","op":">","value":18}]}`,
+			want:  []string{"groups[0] unsatisfiable"},
+		},
+		{
+			name:  "between outside a bound",
+			group: `{"combine_with":"AND","filters":[{"field":"age","op":"BETWEEN","value":[18,25]},{"field":"age","op":">","value":30}]}`,
+			want:  []string{"groups[0] unsatisfiable"},
+		},
+		{
+			name:  "satisfiable range",
+			group: `{"combine_with":"AND","filters":[{"field":"age","op":">","value":18},{"field":"age","op":"<","value":65}]}`,
+		},
+		{
+			name:  "overlapping ranges",
+			group: `{"combine_with":"OR","filters":[{"field":"age","op":">","value":30},{"field":"age","op":"<","value":40}]}`,
+			want:  []string{"groups[0] tautology"},
+		},
+		{
+			name:  "ranges meeting at an inclusive bound",
+			group: `{"combine_with":"OR","filters":[{"field":"age","op":">=","value":30},{"field":"age","op":"<","value":30}]}`,
+			want:  []string{"groups[0] tautology"},
+		},
+		{
+			// The loosest lower bound, >= 30, closes the gap at 30
+			name:  "loosest bound under or",
+			group: `{"combine_with":"OR","filters":[{"field":"age","op":">","value":30},{"field":"age","op":">=","value":30},{"field":"age","op":"<","value":30}]}`,
+			want:  []string{"groups[0] tautology"},
+		},
+		{
+			name:  "ranges leaving a gap",
+			group: `{"combine_with":"OR","filters":[{"field":"age","op":">","value":30},{"field":"age","op":"<","value":30}]}`,
+		},
+		{
+			name:  "equality or inequality",
+			group: `{"combine_with":"OR","filters":[{"field":"country","op":"=","value":"US"},{"field":"country","op":"!=","value":"US"}]}`,
+			want:  []string{"groups[0] tautology"},
+		},
+		{
+			name:  "two inequalities",
+			group: `{"combine_with":"OR","filters":[{"field":"country","op":"!=","value":"US"},{"field":"country","op":"!=","value":"CA"}]}`,
+			want:  []string{"groups[0] tautology"},
+		},
+		{
+			name:  "null or not null",
+			group: `{"combine_with":"OR","filters":[{"field":"age","op":"IS_NULL"},{"field":"age","op":"IS_NOT_NULL"}]}`,
+			want:  []string{"groups[0] tautology"},
+		},
+		{
+			name:  "negated unsatisfiable group",
+			group: `{"combine_with":"AND","negate":true,"filters":[{"field":"age","op":">","value":40},{"field":"age","op":"<","value":20}]}`,
+			want:  []string{"groups[0] tautology"},
+		},
+		{
+			name:  "negated tautology",
+			group: `{"combine_with":"OR","negate":true,"filters":[{"field":"app_version","op":">","value":"2.0.0"},{"field":"app_version","op":"<=","value":"10.0.0"}]}`,
+			want:  []string{"groups[0] unsatisfiable"},
+		},
+		{
+			name:  "nested group",
+			group: `{"combine_with":"OR","groups":[{"combine_with":"AND","filters":[{"field":"last_login_days","op":">=","value":10},{"field":"last_login_days","op":"<","value":3}]}]}`,
+			want:  []string{"groups[0].groups[0] unsatisfiable"},
+		},
+		{
+			name:  "scoped group",
+			group: `{"combine_with":"AND","scope":"subscriptions","filters":[{"field":"price","op":">","value":10},{"field":"price","op":"<=","value":5}]}`,
+			want:  []string{"groups[0] unsatisfiable"},
+		},
+		{
+			// Each condition may hold on a different subscription
+			name:  "related entity without a scope",
+			group: `{"combine_with":"AND","filters":[{"field":"price","op":">","value":10},{"field":"price","op":"<=","value":5}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := buildQuery(t, `{"combine_with":"AND","groups":[`+tt.group+`]}`)
+
+			var got []string
+			for _, warning := range query.Warnings {
+				got = append(got, fmt.Sprintf("%s %s", warning.Path, warning.Code))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("warnings = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
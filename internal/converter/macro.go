@@ -0,0 +1,237 @@
+package converter
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	models "github.com/shahariaz/user_segmentation/internal/model"
+)
+
+// Reason codes reported for macro references
+const (
+	CodeUnknownMacro = "unknown_macro"
+	CodeMacroCycle   = "macro_cycle"
+)
+
+// WithMacros sets the filter macros that queries can reference by name
+func WithMacros(macros map[string]models.FilterMacro) Option {
+	return func(c *Converter) {
+		c.macros = macros
+	}
+}
+
+// expandGroupMacro returns the group a macro reference stands for, or the
+// group itself when it does not reference one. Issues inside the expansion
+// are reported under path + ".macro".
+func (c *Converter) expandGroupMacro(group models.Group, path string, report *ValidationError) (models.Group, bool) {
+	if group.Macro == "" {
+		return group, true
+	}
+
+	if len(group.Filters) > 0 || len(group.Groups) > 0 || group.Scope != "" {
+		report.add(path+".macro", CodeInvalidValue,
+			fmt.Sprintf("group referencing macro %q also has filters, groups or a scope", group.Macro),
+			"move the other conditions to a sibling group")
+		return group, false
+	}
+
+	expanded, ok := c.instantiateMacro(group.Macro, group.Args, path+".macro", nil, report)
+	expanded.Negate = expanded.Negate != group.Negate
+	return expanded, ok
+}
+
+// expandFilterMacro returns the group a filter referencing a macro stands for
+func (c *Converter) expandFilterMacro(filter models.Filter, path string, report *ValidationError) (models.Group, bool) {
+	if filter.Field != "" || filter.Op != "" || filter.Aggregate != "" || filter.Relationship != "" {
+		report.add(path+".macro", CodeInvalidValue,
+			fmt.Sprintf("filter referencing macro %q also has a field, operator or relationship", filter.Macro),
+			"move the condition to a separate filter")
+		return models.Group{}, false
+	}
+
+	return c.instantiateMacro(filter.Macro, filter.Args, path+".macro", nil, report)
+}
+
+// instantiateMacro binds the arguments of a macro reference and expands the
+// macros its definition references in turn. stack holds the macros being
+// expanded, so that a macro reaching itself is reported instead of looping.
+func (c *Converter) instantiateMacro(name string, args map[string]interface{}, path string, stack []string, report *ValidationError) (models.Group, bool) {
+	stack = append(slices.Clone(stack), name)
+	if slices.Contains(stack[:len(stack)-1], name) {
+		report.add(path, CodeMacroCycle,
+			fmt.Sprintf("macro %q references itself through %s", name, strings.Join(stack, " -> ")),
+			"remove the reference that closes the cycle from the macro definitions")
+		return models.Group{}, false
+	}
+
+	macro, exists := c.macros[name]
+	if !exists {
+		report.add(path, CodeUnknownMacro,
+			fmt.Sprintf("unknown macro %q", name),
+			"use one of: "+strings.Join(c.macroNames(), ", "))
+		return models.Group{}, false
+	}
+
+	valid := true
+	values := make(map[string]interface{}, len(macro.Params))
+	for param, value := range macro.Params {
+		values[param] = value
+	}
+	for _, param := range sortedKeys(args) {
+		if _, declared := macro.Params[param]; !declared {
+			report.add(joinPath(path, "args."+param), CodeInvalidValue,
+				fmt.Sprintf("macro %q has no parameter %q", name, param),
+				"use one of: "+strings.Join(sortedKeys(macro.Params), ", "))
+			valid = false
+			continue
+		}
+		values[param] = args[param]
+	}
+	for _, param := range sortedKeys(values) {
+		if values[param] == nil {
+			report.add(joinPath(path, "args"), CodeInvalidValue,
+				fmt.Sprintf("macro %q requires parameter %q", name, param), "")
+			valid = false
+		}
+	}
+	if !valid {
+		return models.Group{}, false
+	}
+
+	undeclared := func(param string) {
+		report.add(path, CodeInvalidValue,
+			fmt.Sprintf("macro %q uses undeclared parameter %q", name, param),
+			"declare the parameter in the macro definition")
+		valid = false
+	}
+	group := substituteGroup(macro.Group, values, undeclared)
+	if !valid {
+		return models.Group{}, false
+	}
+
+	return c.expandDefinition(group, path, stack, report)
+}
+
+// expandDefinition expands the macro references inside an instantiated macro.
+// Referencing filters become nested groups, which leaves the group's meaning
+// unchanged since AND and OR do not depend on the order of their operands.
+func (c *Converter) expandDefinition(group models.Group, path string, stack []string, report *ValidationError) (models.Group, bool) {
+	if group.Macro != "" {
+		expanded, ok := c.instantiateMacro(group.Macro, group.Args, path, stack, report)
+		expanded.Negate = expanded.Negate != group.Negate
+		return expanded, ok
+	}
+
+	valid := true
+	var filters []models.Filter
+	var groups []models.Group
+
+	for _, filter := range group.Filters {
+		if filter.Macro != "" {
+			expanded, ok := c.instantiateMacro(filter.Macro, filter.Args, path, stack, report)
+			groups = append(groups, expanded)
+			valid = valid && ok
+			continue
+		}
+		if filter.Where != nil {
+			where, ok := c.expandDefinition(*filter.Where, path, stack, report)
+			filter.Where = &where
+			valid = valid && ok
+		}
+		filters = append(filters, filter)
+	}
+
+	for _, nestedGroup := range group.Groups {
+		expanded, ok := c.expandDefinition(nestedGroup, path, stack, report)
+		groups = append(groups, expanded)
+		valid = valid && ok
+	}
+
+	group.Filters = filters
+	group.Groups = groups
+	return group, valid
+}
+
+// substituteGroup returns a copy of a macro group with each {"param": name}
+// value replaced by the parameter's value. Parameters missing from values are
+// passed to undeclared and left in place.
+func substituteGroup(group models.Group, values map[string]interface{}, undeclared func(string)) models.Group {
+	group.Args = substituteArgs(group.Args, values, undeclared)
+
+	filters := make([]models.Filter, 0, len(group.Filters))
+	for _, filter := range group.Filters {
+		filter.Value = substituteValue(filter.Value, values, undeclared)
+		filter.Args = substituteArgs(filter.Args, values, undeclared)
+		if filter.Where != nil {
+			where := substituteGroup(*filter.Where, values, undeclared)
+			filter.Where = &where
+		}
+		filters = append(filters, filter)
+	}
+	group.Filters = filters
+
+	groups := make([]models.Group, 0, len(group.Groups))
+	for _, nestedGroup := range group.Groups {
+		groups = append(groups, substituteGroup(nestedGroup, values, undeclared))
+	}
+	group.Groups = groups
+
+	return group
+}
+
+func substituteArgs(args map[string]interface{}, values map[string]interface{}, undeclared func(string)) map[string]interface{} {
+	if args == nil {
+		return nil
+	}
+	substituted := make(map[string]interface{}, len(args))
+	for name, value := range args {
+		substituted[name] = substituteValue(value, values, undeclared)
+	}
+	return substituted
+}
+
+// substituteValue replaces parameter placeholders in a filter value, including
+// inside lists and {"min": .., "max": ..} objects
+func substituteValue(value interface{}, values map[string]interface{}, undeclared func(string)) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		items := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			items = append(items, substituteValue(item, values, undeclared))
+		}
+		return items
+
+	case map[string]interface{}:
+		if param, ok := v["param"].(string); ok && len(v) == 1 {
+			if value, declared := values[param]; declared {
+				return value
+			}
+			undeclared(param)
+			return v
+		}
+		return substituteArgs(v, values, undeclared)
+	}
+
+	return value
+}
+
+// macroNames returns the names of the configured macros in sorted order
+func (c *Converter) macroNames() []string {
+	names := make([]string, 0, len(c.macros))
+	for name := range c.macros {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedKeys(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,196 @@
+package converter
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	models "github.com/shahariaz/user_segmentation/internal/model"
+)
+
+// testMacros returns a small macro set covering parameters, nested references
+// and cycles
+func testMacros() map[string]models.FilterMacro {
+	param := func(name string) map[string]interface{} {
+		return map[string]interface{}{"param": name}
+	}
+
+	return map[string]models.FilterMacro{
+		"active": {
+			Group: models.Group{CombineWith: "AND", Filters: []models.Filter{{Field: "is_active", Op: "=", Value: true}}},
+		},
+		"from": {
+			Params: map[string]interface{}{"country": nil},
+			Group:  models.Group{CombineWith: "AND", Filters: []models.Filter{{Field: "country", Op: "=", Value: param("country")}}},
+		},
+		"local": {
+			Params: map[string]interface{}{"city": "NYC"},
+			Group:  models.Group{CombineWith: "AND", Filters: []models.Filter{{Field: "city", Op: "=", Value: param("city")}}},
+		},
+		"from_any": {
+			Params: map[string]interface{}{"countries": nil},
+			Group:  models.Group{CombineWith: "AND", Filters: []models.Filter{{Field: "country", Op: "IN", Value: param("countries")}}},
+		},
+		"active_from": {
+			Params: map[string]interface{}{"country": nil},
+			Group: models.Group{CombineWith: "AND", Filters: []models.Filter{
+				{Macro: "active"},
+				{Macro: "from", Args: map[string]interface{}{"country": param("country")}},
+			}},
+		},
+		"undeclared": {
+			Group: models.Group{CombineWith: "AND", Filters: []models.Filter{{Field: "city", Op: "=", Value: param("town")}}},
+		},
+		"self":  {Group: models.Group{Macro: "self"}},
+		"loop":  {Group: models.Group{CombineWith: "AND", Filters: []models.Filter{{Macro: "loop"}}}},
+		"ping":  {Group: models.Group{Macro: "pong"}},
+		"pong":  {Group: models.Group{CombineWith: "AND", Filters: []models.Filter{{Macro: "ping"}}}},
+		"outer": {Group: models.Group{Macro: "ping"}},
+	}
+}
+
+func TestMacroExpansion(t *testing.T) {
+	tests := []struct {
+		name       string
+		group      string
+		conditions []string
+	}{
+		{
+			name:       "group reference",
+			group:      `{"macro":"active"}`,
+			conditions: []string{`eq(customers.is_active, "true")`},
+		},
+		{
+			name:       "argument",
+			group:      `{"macro":"from","args":{"country":"US"}}`,
+			conditions: []string{`eq(customers.country, "US")`},
+		},
+		{
+			name:       "default argument",
+			group:      `{"macro":"local"}`,
+			conditions: []string{`eq(customers.city, "NYC")`},
+		},
+		{
+			name:       "argument replacing a default",
+			group:      `{"macro":"local","args":{"city":"LA"}}`,
+			conditions: []string{`eq(customers.city, "LA")`},
+		},
+		{
+			name:       "list argument",
+			group:      `{"macro":"from_any","args":{"countries":["US","CA"]}}`,
+			conditions: []string{`eq(customers.country, ["US", "CA"])`},
+		},
+		{
+			name:       "filter reference",
+			group:      `{"combine_with":"AND","filters":[{"macro":"active"},{"field":"city","op":"=","value":"NYC"}]}`,
+			conditions: []string{`eq(customers.is_active, "true")`, `eq(customers.city, "NYC")`},
+		},
+		{
+			name:       "argument passed to a nested macro",
+			group:      `{"macro":"active_from","args":{"country":"US"}}`,
+			conditions: []string{`eq(customers.country, "US")`, `eq(customers.is_active, "true")`},
+		},
+		{
+			name:       "negated reference",
+			group:      `{"macro":"from","negate":true,"args":{"country":"US"}}`,
+			conditions: []string{`NOT eq(customers.country, "US")`},
+		},
+	}
+
+	c := NewConverter(WithMacros(testMacros()))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := buildQueryWith(t, c, `{"combine_with":"AND","groups":[`+tt.group+`]}`)
+
+			if got := conditions(query); !reflect.DeepEqual(got, tt.conditions) {
+				t.Errorf("conditions = %q, want %q", got, tt.conditions)
+			}
+		})
+	}
+}
+
+func TestMacroErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		group   string
+		issues  []string
+		message string
+	}{
+		{
+			name:    "missing required argument",
+			group:   `{"macro":"from"}`,
+			issues:  []string{"groups[0].macro.args invalid_value"},
+			message: `macro "from" requires parameter "country"`,
+		},
+		{
+			name:   "unknown argument",
+			group:  `{"macro":"local","args":{"town":"LA"}}`,
+			issues: []string{"groups[0].macro.args.town invalid_value"},
+		},
+		{
+			name:    "undeclared parameter in the definition",
+			group:   `{"macro":"undeclared"}`,
+			issues:  []string{"groups[0].macro invalid_value"},
+			message: `macro "undeclared" uses undeclared parameter "town"`,
+		},
+		{
+			name:   "unknown macro",
+			group:  `{"macro":"missing"}`,
+			issues: []string{"groups[0].macro unknown_macro"},
+		},
+		{
+			name:   "reference with other conditions",
+			group:  `{"macro":"active","filters":[{"field":"city","op":"=","value":"NYC"}]}`,
+			issues: []string{"groups[0].macro invalid_value"},
+		},
+		{
+			name:    "self reference",
+			group:   `{"macro":"self"}`,
+			issues:  []string{"groups[0].macro macro_cycle"},
+			message: "self -> self",
+		},
+		{
+			name:    "self reference from a filter",
+			group:   `{"macro":"loop"}`,
+			issues:  []string{"groups[0].macro macro_cycle"},
+			message: "loop -> loop",
+		},
+		{
+			name:    "mutual recursion",
+			group:   `{"macro":"ping"}`,
+			issues:  []string{"groups[0].macro macro_cycle"},
+			message: "ping -> pong -> ping",
+		},
+		{
+			name:    "mutual recursion from a filter",
+			group:   `{"combine_with":"AND","filters":[{"macro":"pong"}]}`,
+			issues:  []string{"groups[0].filters[0].macro macro_cycle"},
+			message: "pong -> ping -> pong",
+		},
+		{
+			name:    "cycle below the reference",
+			group:   `{"macro":"outer"}`,
+			issues:  []string{"groups[0].macro macro_cycle"},
+			message: "outer -> ping -> pong -> ping",
+		},
+	}
+
+	c := NewConverter(WithMacros(testMacros()))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues := validationIssuesWith(t, c, `{"combine_with":"AND","groups":[`+tt.group+`]}`)
+
+			var got []string
+			for _, issue := range issues {
+				got = append(got, fmt.Sprintf("%s %s", issue.Path, issue.Code))
+			}
+			if !reflect.DeepEqual(got, tt.issues) {
+				t.Fatalf("issues = %q, want %q", got, tt.issues)
+			}
+			if !strings.Contains(issues[0].Message, tt.message) {
+				t.Errorf("message = %q, want it to contain %q", issues[0].Message, tt.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package converter
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	models "github.com/shahariaz/user_segmentation/internal/model"
+)
+
+// uidPattern matches a Dgraph uid such as 0x2a
+var uidPattern = regexp.MustCompile(`^0x[0-9a-f]+$`)
+
+// cursor is the decoded form of an opaque pagination cursor
+type cursor struct {
+	Entity string `json:"e"`
+	After  string `json:"a"`
+}
+
+// EncodeCursor returns an opaque cursor resuming a segment of the given entity
+// type after the record with the given uid
+func EncodeCursor(entityType, afterUID string) string {
+	data, _ := json.Marshal(cursor{Entity: entityType, After: afterUID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(encoded string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("cursor is not valid base64: %w", err)
+	}
+
+	var decoded cursor
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, fmt.Errorf("cursor is malformed: %w", err)
+	}
+	if !uidPattern.MatchString(decoded.After) {
+		return nil, fmt.Errorf("cursor holds an invalid uid %q", decoded.After)
+	}
+
+	return &decoded, nil
+}
+
+// buildPagination returns the page of the main block. A cursor pages by uid
+// with after: instead of offset, which stays fast and stable however deep the
+// page is.
+func (c *Converter) buildPagination(jsonQuery *models.JSONQuery, mainEntityType string, report *ValidationError) *Page {
+	limit := jsonQuery.Limit
+	offset := jsonQuery.Offset
+	if limit == 0 {
+		limit = c.pagination["default_limit"]
+	}
+	c.checkLimit(limit, "limit", report)
+	if offset < 0 {
+		report.add("offset", CodeInvalidValue, "offset must not be negative", "")
+	}
+
+	if jsonQuery.Cursor == "" {
+		return &Page{First: limit, Offset: offset}
+	}
+
+	decoded, err := decodeCursor(jsonQuery.Cursor)
+	if err != nil {
+		report.add("cursor", CodeInvalidValue, err.Error(),
+			"pass the next_cursor returned by the previous page unchanged")
+		return &Page{First: limit}
+	}
+	if decoded.Entity != mainEntityType {
+		report.add("cursor", CodeInvalidValue,
+			fmt.Sprintf("cursor belongs to a %q segment, not %q", decoded.Entity, mainEntityType), "")
+	}
+	if offset != 0 {
+		report.add("offset", CodeInvalidValue, "offset cannot be combined with a cursor", "remove offset")
+	}
+	if len(jsonQuery.Sort) > 0 {
+		report.add("sort", CodeInvalidValue, "cursor pagination walks the segment in uid order and cannot be sorted",
+			"remove sort or use offset pagination")
+	}
+
+	return &Page{First: limit, After: decoded.After}
+}
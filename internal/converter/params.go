@@ -0,0 +1,78 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+
+	models "github.com/shahariaz/user_segmentation/internal/model"
+)
+
+// queryParams collects the GraphQL variables of a query so that filter values
+// are sent alongside the DQL text instead of being interpolated into it
+type queryParams struct {
+	list []models.QueryParam
+}
+
+// bind registers a value and returns the variable name to use in its place
+func (p *queryParams) bind(value, dqlType string) string {
+	name := fmt.Sprintf("$v%d", len(p.list))
+	p.list = append(p.list, models.QueryParam{Name: name, Type: dqlType, Value: value})
+	return name
+}
+
+// bindValue binds a filter value converted for the field data type. It returns
+// "" when the value cannot be represented in that type.
+func (c *Converter) bindValue(params *queryParams, value interface{}, dataType string) string {
+	raw, ok := c.rawValue(value, dataType)
+	if !ok {
+		return ""
+	}
+	return params.bind(raw, variableType(dataType))
+}
+
+// variableType maps a field data type to the DQL variable type carrying it
+func variableType(dataType string) string {
+	switch dataType {
+	case "int", "float", "bool":
+		return dataType
+	default:
+		return "string"
+	}
+}
+
+// regexLiteral renders a pattern as a DQL regex literal, escaping the slashes
+// that would otherwise terminate it
+func regexLiteral(pattern string) string {
+	var b strings.Builder
+	b.WriteByte('/')
+
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '/':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	if escaped {
+		// A trailing backslash would escape the closing slash
+		b.WriteByte('\\')
+	}
+
+	b.WriteByte('/')
+	return b.String()
+}
+
+// GenerateDQLVariables returns the variable values to send with the query
+// produced by GenerateDQLString
+func (c *Converter) GenerateDQLVariables(dqlQuery *models.DQLQuery) map[string]string {
+	vars := make(map[string]string, len(dqlQuery.Params))
+	for _, param := range dqlQuery.Params {
+		vars[param.Name] = param.Value
+	}
+	return vars
+}
@@ -0,0 +1,222 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+
+	models "github.com/shahariaz/user_segmentation/internal/model"
+)
+
+// Print renders a query tree as the DQLQuery blocks GenerateDQLString joins
+// into query text
+func Print(query *Query) *models.DQLQuery {
+	variables := make([]models.VariableBlock, 0, len(query.Vars))
+	for _, block := range query.Vars {
+		variables = append(variables, printVarBlock(block))
+	}
+
+	filter := ""
+	if query.Filter != nil {
+		filter = fmt.Sprintf("@filter(%s)", printCondition(query.Filter))
+	}
+
+	pagination, limit := "", 0
+	if query.Page != nil {
+		pagination, limit = printPage(query.Page), query.Page.First
+	}
+
+	return &models.DQLQuery{
+		Variables: variables,
+		MainQuery: models.MainQuery{
+			Name:       query.Name,
+			Type:       query.Type,
+			Function:   PrintExpr(query.Root),
+			Filter:     filter,
+			Fields:     printSelection(query.Selection, 0),
+			Pagination: pagination,
+			Ordering:   strings.Join(printOrder(query.Order), ", "),
+			Limit:      limit,
+		},
+		Params:   query.Params,
+		Warnings: query.Warnings,
+	}
+}
+
+// PrintExpr renders a filter condition. Combinations of several operands are
+// parenthesized so that they can be embedded in any other condition.
+func PrintExpr(expr Expr) string {
+	switch e := expr.(type) {
+	case *Comparison:
+		var arguments []string
+		switch {
+		case e.ValueVar != "":
+			arguments = append(arguments, fmt.Sprintf("val(%s)", e.ValueVar))
+		case e.Predicate != "":
+			arguments = append(arguments, e.Predicate)
+		}
+		if e.Func == "eq" && len(e.Args) > 1 {
+			// eq matches any value of a list
+			arguments = append(arguments, "["+strings.Join(e.Args, ", ")+"]")
+		} else {
+			arguments = append(arguments, e.Args...)
+		}
+		return fmt.Sprintf("%s(%s)", e.Func, strings.Join(arguments, ", "))
+
+	case *VarRef:
+		return fmt.Sprintf("uid(%s)", e.Name)
+
+	case *Not:
+		return "NOT " + PrintExpr(e.Operand)
+
+	case *BoolOp:
+		if len(e.Operands) == 1 {
+			return PrintExpr(e.Operands[0])
+		}
+		return "(" + printOperands(e) + ")"
+	}
+
+	return ""
+}
+
+// printCondition renders the outermost condition of a @filter, whose own
+// parentheses make another pair around a combination redundant
+func printCondition(expr Expr) string {
+	if op, ok := expr.(*BoolOp); ok {
+		return printOperands(op)
+	}
+	return PrintExpr(expr)
+}
+
+func printOperands(op *BoolOp) string {
+	parts := make([]string, 0, len(op.Operands))
+	for _, operand := range op.Operands {
+		parts = append(parts, PrintExpr(operand))
+	}
+	return strings.Join(parts, " "+op.Op+" ")
+}
+
+// printSelection renders the fields and nested blocks of a selection at the
+// given nesting depth below the query block
+func printSelection(selection Selection, depth int) string {
+	indent := strings.Repeat("  ", depth+2)
+	if selection.Count {
+		return indent + "count(uid)"
+	}
+
+	var lines []string
+	for _, field := range selection.Fields {
+		lines = append(lines, indent+field)
+	}
+	if selection.ExpandAll {
+		lines = append(lines, indent+"expand(_all_)")
+	}
+	for _, edge := range selection.Edges {
+		lines = append(lines, printEdgeSelection(edge, depth))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// printEdgeSelection renders a nested block with its own limit, ordering and
+// filter
+func printEdgeSelection(edge EdgeSelection, depth int) string {
+	var arguments []string
+	if edge.First > 0 {
+		arguments = append(arguments, fmt.Sprintf("first: %d", edge.First))
+	}
+	arguments = append(arguments, printOrder(edge.Order)...)
+
+	header := edge.Edge
+	if len(arguments) > 0 {
+		header += " (" + strings.Join(arguments, ", ") + ")"
+	}
+	if edge.Filter != nil {
+		header += fmt.Sprintf(" @filter(%s)", PrintExpr(edge.Filter))
+	}
+
+	indent := strings.Repeat("  ", depth+2)
+	return fmt.Sprintf("%s%s {\n%s\n%s}", indent, header, printSelection(edge.Selection, depth+1), indent)
+}
+
+// printOrder renders sort keys as orderasc/orderdesc arguments
+func printOrder(keys []OrderKey) []string {
+	arguments := make([]string, 0, len(keys))
+	for _, key := range keys {
+		order := "orderasc"
+		if key.Desc {
+			order = "orderdesc"
+		}
+
+		target := key.Predicate
+		if key.ValueVar != "" {
+			target = fmt.Sprintf("val(%s)", key.ValueVar)
+		}
+		arguments = append(arguments, fmt.Sprintf("%s: %s", order, target))
+	}
+	return arguments
+}
+
+// printPage renders the pagination arguments of the main block
+func printPage(page *Page) string {
+	if page.After != "" {
+		return fmt.Sprintf("first: %d, after: %s", page.First, page.After)
+	}
+	return fmt.Sprintf("first: %d, offset: %d", page.First, page.Offset)
+}
+
+// printVarBlock renders the body of a var block
+func printVarBlock(block VarBlock) models.VariableBlock {
+	variable := models.VariableBlock{Name: block.Name, Type: block.Type}
+
+	switch {
+	case block.Traversal != nil:
+		variable.Fields = printTraversal(block.Traversal)
+		variable.Cascade = true
+	case block.Aggregate != nil:
+		variable.Fields = printAggregate(block.Aggregate)
+	}
+
+	return variable
+}
+
+// printTraversal nests the filter under the chain of edges so that a
+// cascading var block keeps only root nodes with a matching related node
+func printTraversal(traversal *Traversal) string {
+	var lines []string
+	last := len(traversal.Edges) - 1
+
+	for depth, edge := range traversal.Edges {
+		indent := strings.Repeat("  ", depth+2)
+		if depth == last {
+			if traversal.Filter != nil {
+				edge += fmt.Sprintf(" @filter(%s)", PrintExpr(traversal.Filter))
+			}
+			lines = append(lines, fmt.Sprintf("%s%s {", indent, edge))
+			lines = append(lines, indent+"  uid")
+		} else {
+			lines = append(lines, fmt.Sprintf("%s%s {", indent, edge))
+		}
+	}
+
+	for depth := last; depth >= 0; depth-- {
+		lines = append(lines, strings.Repeat("  ", depth+2)+"}")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// printAggregate renders the value variable definitions of an aggregate
+func printAggregate(aggregate *Aggregate) string {
+	edgeFilter := ""
+	if aggregate.Filter != nil {
+		edgeFilter = fmt.Sprintf(" @filter(%s)", PrintExpr(aggregate.Filter))
+	}
+
+	if aggregate.Func == "count" {
+		return fmt.Sprintf("    %s as count(%s%s)", aggregate.Var, aggregate.Edge, edgeFilter)
+	}
+
+	return fmt.Sprintf("    %s%s {\n      %s as %s\n    }\n    %s as %s(val(%s))",
+		aggregate.Edge, edgeFilter, aggregate.ValueVar, aggregate.Predicate,
+		aggregate.Var, aggregate.Func, aggregate.ValueVar)
+}
@@ -0,0 +1,180 @@
+package converter
+
+import (
+	"testing"
+
+	models "github.com/shahariaz/user_segmentation/internal/model"
+)
+
+func TestPrintExpr(t *testing.T) {
+	country := newComparison("eq", "customers.country", "$v0")
+	city := newComparison("eq", "customers.city", "$v1")
+	age := newComparison("gt", "customers.age", "$v2")
+
+	tests := []struct {
+		name string
+		expr Expr
+		want string
+	}{
+		{name: "comparison", expr: age, want: "gt(customers.age, $v2)"},
+		{name: "no arguments", expr: newComparison("has", "customers.email"), want: "has(customers.email)"},
+		{name: "no predicate", expr: newComparison("type", "", "customers"), want: "type(customers)"},
+		{name: "eq list", expr: newComparison("eq", "customers.country", "$v0", "$v1"), want: "eq(customers.country, [$v0, $v1])"},
+		{
+			name: "between",
+			expr: newComparison("between", "customers.age", "$v0", "$v1"),
+			want: "between(customers.age, $v0, $v1)",
+		},
+		{
+			name: "value variable",
+			expr: &Comparison{Func: "ge", ValueVar: "var0", Args: []string{"$v0"}},
+			want: "ge(val(var0), $v0)",
+		},
+		{name: "var block", expr: &VarRef{Name: "var1"}, want: "uid(var1)"},
+		{name: "and", expr: newAnd(country, age), want: "(eq(customers.country, $v0) AND gt(customers.age, $v2))"},
+		{name: "single operand", expr: &BoolOp{Op: "OR", Operands: []Expr{age}}, want: "gt(customers.age, $v2)"},
+		{
+			name: "or inside and",
+			expr: newAnd(age, newOr(country, city)),
+			want: "(gt(customers.age, $v2) AND (eq(customers.country, $v0) OR eq(customers.city, $v1)))",
+		},
+		{name: "not", expr: newNot(country), want: "NOT eq(customers.country, $v0)"},
+		{
+			name: "not over or",
+			expr: newNot(newOr(country, &VarRef{Name: "var0"})),
+			want: "NOT (eq(customers.country, $v0) OR uid(var0))",
+		},
+		{
+			name: "not inside or",
+			expr: newOr(newNot(newAnd(country, city)), newNot(age)),
+			want: "(NOT (eq(customers.country, $v0) AND eq(customers.city, $v1)) OR NOT gt(customers.age, $v2))",
+		},
+		{name: "nested not", expr: &Not{Operand: &Not{Operand: age}}, want: "NOT NOT gt(customers.age, $v2)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PrintExpr(tt.expr); got != tt.want {
+				t.Errorf("PrintExpr = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrint(t *testing.T) {
+	params := []models.QueryParam{
+		{Name: "$v0", Type: "float", Value: "50"},
+		{Name: "$v1", Type: "string", Value: "US"},
+		{Name: "$v2", Type: "int", Value: "3"},
+		{Name: "$v3", Type: "string", Value: "active"},
+	}
+	vars := []VarBlock{
+		traversal("var0", newComparison("gt", "contents.rating", "$v0"), "customers.watch_histories", "watch_histories.content"),
+		{Type: "customers", Aggregate: &Aggregate{Var: "var1", Func: "count", Edge: "customers.devices"}},
+		{Type: "customers", Aggregate: &Aggregate{
+			Var: "var2", Func: "sum", Edge: "customers.purchases",
+			Filter: newComparison("eq", "purchases.status", "$v3"), Predicate: "purchases.amount", ValueVar: "var3",
+		}},
+	}
+
+	tests := []struct {
+		name  string
+		query *Query
+		want  string
+	}{
+		{
+			name: "segment",
+			query: &Query{
+				Vars:   vars,
+				Name:   "customers",
+				Type:   "customers",
+				Root:   newComparison("eq", "customers.country", "$v1"),
+				Filter: newAnd(newComparison("type", "", "customers"), newNot(&VarRef{Name: "var0"}), &Comparison{Func: "ge", ValueVar: "var1", Args: []string{"$v2"}}),
+				Selection: Selection{
+					Fields: []string{"uid", "customers.name"},
+					Edges: []EdgeSelection{{
+						Edge:   "customers.subscriptions",
+						Filter: newComparison("eq", "subscriptions.status", "$v3"),
+						Order:  []OrderKey{{Predicate: "subscriptions.start_date", Desc: true}},
+						First:  5,
+						Selection: Selection{
+							Fields: []string{"uid", "subscriptions.package"},
+						},
+					}},
+				},
+				Order:  []OrderKey{{ValueVar: "var2", Desc: true}, {Predicate: "customers.name"}},
+				Page:   &Page{First: 100, Offset: 200},
+				Params: params,
+			},
+			want: `query segment($v0: float, $v1: string, $v2: int, $v3: string) {
+  var0 as var(func: type(customers)) @cascade {
+    customers.watch_histories {
+      watch_histories.content @filter(gt(contents.rating, $v0)) {
+        uid
+      }
+    }
+  }
+  var(func: type(customers)) {
+    var1 as count(customers.devices)
+  }
+  var(func: type(customers)) {
+    customers.purchases @filter(eq(purchases.status, $v3)) {
+      var3 as purchases.amount
+    }
+    var2 as sum(val(var3))
+  }
+  customers(func: eq(customers.country, $v1), orderdesc: val(var2), orderasc: customers.name, first: 100, offset: 200) @filter(type(customers) AND NOT uid(var0) AND ge(val(var1), $v2)) {
+    uid
+    customers.name
+    customers.subscriptions (first: 5, orderdesc: subscriptions.start_date) @filter(eq(subscriptions.status, $v3)) {
+      uid
+      subscriptions.package
+    }
+  }
+}`,
+		},
+		{
+			name: "count",
+			query: &Query{
+				Name:      "customers",
+				Type:      "customers",
+				Root:      newComparison("type", "", "customers"),
+				Filter:    newOr(newComparison("eq", "customers.country", "$v1"), newComparison("eq", "customers.status", "$v3")),
+				Selection: Selection{Count: true},
+				Params:    []models.QueryParam{params[1], params[3]},
+			},
+			want: `query segment($v1: string, $v3: string) {
+  customers(func: type(customers)) @filter(eq(customers.country, $v1) OR eq(customers.status, $v3)) {
+    count(uid)
+  }
+}`,
+		},
+		{
+			name: "cursor",
+			query: &Query{
+				Name:      "customers",
+				Type:      "customers",
+				Root:      newComparison("type", "", "customers"),
+				Selection: Selection{Fields: []string{"uid"}, ExpandAll: true},
+				Page:      &Page{First: 10, After: "0x2a"},
+			},
+			// Without parameters the query is anonymous, and without a
+			// filter the block keeps the space left for one
+			want: `query {
+  customers(func: type(customers), first: 10, after: 0x2a)  {
+    uid
+    expand(_all_)
+  }
+}`,
+		},
+	}
+
+	c := NewConverter()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.GenerateDQLString(Print(tt.query)); got != tt.want {
+				t.Errorf("Print rendered\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
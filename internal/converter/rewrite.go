@@ -0,0 +1,330 @@
+package converter
+
+import (
+	"strconv"
+	"strings"
+
+	models "github.com/shahariaz/user_segmentation/internal/model"
+)
+
+// rewriteQuery shrinks a converted query without changing the nodes it
+// matches:
+//
+//   - OR-ed uid(varN) of var blocks traversing the same edges merge into one
+//     block whose filter ORs theirs, since a root reaching a record matching
+//     a OR b is a root reaching a record matching a or one matching b
+//   - OR-ed eq comparisons of a predicate collapse into eq(pred, [$v0, $v1])
+//   - identical var blocks are kept once and their references renamed
+//   - var blocks left unreferenced are removed
+func rewriteQuery(query *Query) {
+	blocks := make(map[string]*VarBlock)
+	for i := range query.Vars {
+		if query.Vars[i].Traversal != nil {
+			blocks[query.Vars[i].Name] = &query.Vars[i]
+		}
+	}
+
+	references := make(map[string]int)
+	walkExpr(query.Filter, func(expr Expr) {
+		if ref, ok := expr.(*VarRef); ok {
+			references[ref.Name]++
+		}
+	})
+
+	query.Filter = collapseEq(mergeTraversals(query.Filter, blocks, references))
+	for i := range query.Vars {
+		switch block := &query.Vars[i]; {
+		case block.Traversal != nil:
+			block.Traversal.Filter = collapseEq(block.Traversal.Filter)
+		case block.Aggregate != nil:
+			block.Aggregate.Filter = collapseEq(block.Aggregate.Filter)
+		}
+	}
+
+	dedupeVarBlocks(query)
+	dropUnusedVarBlocks(query)
+	dropUnusedParams(query)
+}
+
+// mergeTraversals merges the var blocks of OR-ed uid(varN) operands that
+// traverse the same edges from the same type. Only blocks referenced once are
+// merged, so that widening a block's filter cannot change another condition.
+func mergeTraversals(expr Expr, blocks map[string]*VarBlock, references map[string]int) Expr {
+	switch e := expr.(type) {
+	case *Not:
+		return newNot(mergeTraversals(e.Operand, blocks, references))
+
+	case *BoolOp:
+		operands := make([]Expr, 0, len(e.Operands))
+		for _, operand := range e.Operands {
+			operands = append(operands, mergeTraversals(operand, blocks, references))
+		}
+		if e.Op != "OR" {
+			return &BoolOp{Op: e.Op, Operands: operands}
+		}
+
+		merged := make(map[string]*VarBlock)
+		kept := operands[:0]
+		for _, operand := range operands {
+			ref, ok := operand.(*VarRef)
+			if !ok || blocks[ref.Name] == nil || references[ref.Name] != 1 {
+				kept = append(kept, operand)
+				continue
+			}
+
+			block := blocks[ref.Name]
+			key := block.Type + " " + strings.Join(block.Traversal.Edges, " ")
+			target, found := merged[key]
+			if !found {
+				merged[key] = block
+				kept = append(kept, operand)
+				continue
+			}
+
+			// A block without a filter matches any related record, which
+			// absorbs the other filter
+			if target.Traversal.Filter == nil || block.Traversal.Filter == nil {
+				target.Traversal.Filter = nil
+			} else {
+				target.Traversal.Filter = newOr(target.Traversal.Filter, block.Traversal.Filter)
+			}
+			references[ref.Name] = 0
+		}
+		return newOr(kept...)
+	}
+
+	return expr
+}
+
+// collapseEq flattens nested disjunctions and joins the eq comparisons of a
+// predicate within each into one comparison with a list of values
+func collapseEq(expr Expr) Expr {
+	switch e := expr.(type) {
+	case *Not:
+		return newNot(collapseEq(e.Operand))
+
+	case *BoolOp:
+		var operands []Expr
+		for _, operand := range e.Operands {
+			operand = collapseEq(operand)
+			if nested, ok := operand.(*BoolOp); ok && nested.Op == e.Op && e.Op == "OR" {
+				operands = append(operands, nested.Operands...)
+				continue
+			}
+			operands = append(operands, operand)
+		}
+		if e.Op != "OR" {
+			return &BoolOp{Op: e.Op, Operands: operands}
+		}
+
+		lists := make(map[string]*Comparison)
+		kept := operands[:0]
+		for _, operand := range operands {
+			comparison, ok := operand.(*Comparison)
+			if !ok || comparison.Func != "eq" || comparison.Predicate == "" {
+				kept = append(kept, operand)
+				continue
+			}
+
+			if list, found := lists[comparison.Predicate]; found {
+				list.Args = append(list.Args, comparison.Args...)
+				continue
+			}
+
+			list := newComparison("eq", comparison.Predicate, comparison.Args...)
+			lists[comparison.Predicate] = list
+			kept = append(kept, list)
+		}
+		return newOr(kept...)
+	}
+
+	return expr
+}
+
+// dedupeVarBlocks keeps the first of identical var blocks and points the
+// references to the others at it. Blocks compare by the values bound to their
+// query variables, so two filters written the same way are identical.
+func dedupeVarBlocks(query *Query) {
+	values := paramValues(query.Params)
+	seen := make(map[string]string)
+	renames := make(map[string]string)
+	kept := query.Vars[:0]
+
+	for _, block := range query.Vars {
+		name, key := blockKey(block, values)
+		if first, found := seen[key]; found {
+			renames[name] = first
+			continue
+		}
+		seen[key] = name
+		kept = append(kept, block)
+	}
+	query.Vars = kept
+
+	if len(renames) == 0 {
+		return
+	}
+
+	walkExpr(query.Filter, func(expr Expr) {
+		switch e := expr.(type) {
+		case *VarRef:
+			if name, ok := renames[e.Name]; ok {
+				e.Name = name
+			}
+		case *Comparison:
+			if name, ok := renames[e.ValueVar]; ok {
+				e.ValueVar = name
+			}
+		}
+	})
+	// Renaming can leave the same uid(varN) twice in a combination
+	query.Filter = normalizeExpr(query.Filter, values)
+
+	for i, key := range query.Order {
+		if name, ok := renames[key.ValueVar]; ok {
+			query.Order[i].ValueVar = name
+		}
+	}
+}
+
+// blockKey returns the variable a block defines and a key equal for blocks
+// computing the same thing
+func blockKey(block VarBlock, values map[string]models.QueryParam) (string, string) {
+	if block.Aggregate != nil {
+		aggregate := block.Aggregate
+		return aggregate.Var, strings.Join([]string{"aggregate", block.Type, aggregate.Func,
+			aggregate.Edge, aggregate.Predicate, exprKey(aggregate.Filter, values)}, " ")
+	}
+	return block.Name, strings.Join([]string{"traversal", block.Type,
+		strings.Join(block.Traversal.Edges, "/"), exprKey(block.Traversal.Filter, values)}, " ")
+}
+
+// exprKey renders an expression with its query variables replaced by their
+// values
+func exprKey(expr Expr, values map[string]models.QueryParam) string {
+	switch e := expr.(type) {
+	case *Comparison:
+		resolved := *e
+		resolved.Args = make([]string, len(e.Args))
+		for i, arg := range e.Args {
+			resolved.Args[i] = arg
+			if param, ok := values[arg]; ok {
+				resolved.Args[i] = param.Type + ":" + strconv.Quote(param.Value)
+			}
+		}
+		return PrintExpr(&resolved)
+
+	case *Not:
+		return "NOT " + exprKey(e.Operand, values)
+
+	case *BoolOp:
+		parts := make([]string, 0, len(e.Operands))
+		for _, operand := range e.Operands {
+			parts = append(parts, exprKey(operand, values))
+		}
+		return "(" + strings.Join(parts, " "+e.Op+" ") + ")"
+	}
+
+	if expr == nil {
+		return ""
+	}
+	return PrintExpr(expr)
+}
+
+// dropUnusedVarBlocks removes the var blocks no longer referenced, since
+// Dgraph rejects variables that are defined but never used. Traversal blocks
+// are referenced by uid() and aggregate blocks by val() in the filter or the
+// ordering.
+func dropUnusedVarBlocks(query *Query) {
+	used := make(map[string]bool)
+	markVars := func(expr Expr) {
+		switch e := expr.(type) {
+		case *VarRef:
+			used[e.Name] = true
+		case *Comparison:
+			if e.ValueVar != "" {
+				used[e.ValueVar] = true
+			}
+		}
+	}
+
+	walkExpr(query.Root, markVars)
+	walkExpr(query.Filter, markVars)
+	for _, key := range query.Order {
+		if key.ValueVar != "" {
+			used[key.ValueVar] = true
+		}
+	}
+
+	kept := query.Vars[:0]
+	for _, block := range query.Vars {
+		switch {
+		case block.Traversal != nil && !used[block.Name]:
+		case block.Aggregate != nil && !used[block.Aggregate.Var]:
+		default:
+			kept = append(kept, block)
+		}
+	}
+	query.Vars = kept
+}
+
+// dropUnusedParams removes the query variables that belonged to dropped var
+// blocks, since Dgraph rejects variables that are declared but never used
+func dropUnusedParams(query *Query) {
+	used := make(map[string]bool)
+	markArgs := func(expr Expr) {
+		if comparison, ok := expr.(*Comparison); ok {
+			for _, arg := range comparison.Args {
+				used[arg] = true
+			}
+		}
+	}
+
+	walkExpr(query.Root, markArgs)
+	walkExpr(query.Filter, markArgs)
+	for _, block := range query.Vars {
+		switch {
+		case block.Traversal != nil:
+			walkExpr(block.Traversal.Filter, markArgs)
+		case block.Aggregate != nil:
+			walkExpr(block.Aggregate.Filter, markArgs)
+		}
+	}
+	walkSelection(query.Selection, func(edge EdgeSelection) {
+		walkExpr(edge.Filter, markArgs)
+	})
+
+	var params []models.QueryParam
+	for _, param := range query.Params {
+		if used[param.Name] {
+			params = append(params, param)
+		}
+	}
+	query.Params = params
+}
+
+// walkSelection calls visit on every nested block of a selection, parents
+// first
+func walkSelection(selection Selection, visit func(EdgeSelection)) {
+	for _, edge := range selection.Edges {
+		visit(edge)
+		walkSelection(edge.Selection, visit)
+	}
+}
+
+// walkExpr calls visit on every node of an expression, parents first
+func walkExpr(expr Expr, visit func(Expr)) {
+	if expr == nil {
+		return
+	}
+	visit(expr)
+
+	switch e := expr.(type) {
+	case *Not:
+		walkExpr(e.Operand, visit)
+	case *BoolOp:
+		for _, operand := range e.Operands {
+			walkExpr(operand, visit)
+		}
+	}
+}
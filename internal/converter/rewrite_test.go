@@ -0,0 +1,334 @@
+package converter
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	models "github.com/shahariaz/user_segmentation/internal/model"
+)
+
+// traversal returns a customers var block reaching records through edges
+func traversal(name string, filter Expr, edges ...string) VarBlock {
+	return VarBlock{Name: name, Type: "customers", Traversal: &Traversal{Edges: edges, Filter: filter}}
+}
+
+// stringParams returns string query variables $v0, $v1, ... with the values
+func stringParams(values ...string) []models.QueryParam {
+	params := make([]models.QueryParam, 0, len(values))
+	for i, value := range values {
+		params = append(params, models.QueryParam{Name: "$v" + strconv.Itoa(i), Type: "string", Value: value})
+	}
+	return params
+}
+
+func varNames(query *Query) []string {
+	var names []string
+	for _, block := range query.Vars {
+		name, _ := blockKey(block, nil)
+		names = append(names, name)
+	}
+	return names
+}
+
+func paramNames(query *Query) []string {
+	var names []string
+	for _, param := range query.Params {
+		names = append(names, param.Name)
+	}
+	return names
+}
+
+func TestRewriteMergesTraversals(t *testing.T) {
+	active := newComparison("eq", "subscriptions.status", "$v0")
+	premium := newComparison("eq", "subscriptions.package", "$v1")
+
+	tests := []struct {
+		name   string
+		filter Expr
+		vars   []VarBlock
+		want   string
+		blocks map[string]string
+	}{
+		{
+			name:   "or of blocks on the same edges",
+			filter: newOr(&VarRef{Name: "var0"}, &VarRef{Name: "var1"}),
+			vars: []VarBlock{
+				traversal("var0", active, "customers.subscriptions"),
+				traversal("var1", premium, "customers.subscriptions"),
+			},
+			want: "uid(var0)",
+			blocks: map[string]string{
+				"var0": "(eq(subscriptions.status, $v0) OR eq(subscriptions.package, $v1))",
+			},
+		},
+		{
+			// Both conditions must hold, possibly on different records
+			name:   "and of blocks on the same edges",
+			filter: newAnd(&VarRef{Name: "var0"}, &VarRef{Name: "var1"}),
+			vars: []VarBlock{
+				traversal("var0", active, "customers.subscriptions"),
+				traversal("var1", premium, "customers.subscriptions"),
+			},
+			want: "(uid(var0) AND uid(var1))",
+			blocks: map[string]string{
+				"var0": "eq(subscriptions.status, $v0)",
+				"var1": "eq(subscriptions.package, $v1)",
+			},
+		},
+		{
+			name:   "negated or",
+			filter: newNot(newOr(&VarRef{Name: "var0"}, &VarRef{Name: "var1"})),
+			vars: []VarBlock{
+				traversal("var0", active, "customers.subscriptions"),
+				traversal("var1", premium, "customers.subscriptions"),
+			},
+			want: "NOT uid(var0)",
+			blocks: map[string]string{
+				"var0": "(eq(subscriptions.status, $v0) OR eq(subscriptions.package, $v1))",
+			},
+		},
+		{
+			name:   "or nested in an and",
+			filter: newAnd(newComparison("eq", "customers.country", "$v2"), newOr(&VarRef{Name: "var0"}, &VarRef{Name: "var1"})),
+			vars: []VarBlock{
+				traversal("var0", active, "customers.subscriptions"),
+				traversal("var1", premium, "customers.subscriptions"),
+			},
+			want: "(eq(customers.country, $v2) AND uid(var0))",
+			blocks: map[string]string{
+				"var0": "(eq(subscriptions.status, $v0) OR eq(subscriptions.package, $v1))",
+			},
+		},
+		{
+			// Widening var0 would change the condition also using it
+			name: "block referenced elsewhere",
+			filter: newAnd(
+				newOr(&VarRef{Name: "var0"}, &VarRef{Name: "var1"}),
+				newNot(&VarRef{Name: "var0"}),
+			),
+			vars: []VarBlock{
+				traversal("var0", active, "customers.subscriptions"),
+				traversal("var1", premium, "customers.subscriptions"),
+			},
+			want: "((uid(var0) OR uid(var1)) AND NOT uid(var0))",
+			blocks: map[string]string{
+				"var0": "eq(subscriptions.status, $v0)",
+				"var1": "eq(subscriptions.package, $v1)",
+			},
+		},
+		{
+			name:   "blocks on different edges",
+			filter: newOr(&VarRef{Name: "var0"}, &VarRef{Name: "var1"}),
+			vars: []VarBlock{
+				traversal("var0", active, "customers.subscriptions"),
+				traversal("var1", newComparison("eq", "purchases.status", "$v1"), "customers.purchases"),
+			},
+			want: "(uid(var0) OR uid(var1))",
+			blocks: map[string]string{
+				"var0": "eq(subscriptions.status, $v0)",
+				"var1": "eq(purchases.status, $v1)",
+			},
+		},
+		{
+			// Any related record matches a block without a filter
+			name:   "block without a filter",
+			filter: newOr(&VarRef{Name: "var0"}, &VarRef{Name: "var1"}),
+			vars: []VarBlock{
+				traversal("var0", active, "customers.subscriptions"),
+				traversal("var1", nil, "customers.subscriptions"),
+			},
+			want:   "uid(var0)",
+			blocks: map[string]string{"var0": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := &Query{Type: "customers", Filter: tt.filter, Vars: tt.vars, Params: stringParams("active", "Premium", "US")}
+			rewriteQuery(query)
+
+			if got := PrintExpr(query.Filter); got != tt.want {
+				t.Errorf("filter = %s, want %s", got, tt.want)
+			}
+
+			blocks := make(map[string]string)
+			for _, block := range query.Vars {
+				blocks[block.Name] = PrintExpr(block.Traversal.Filter)
+			}
+			if !reflect.DeepEqual(blocks, tt.blocks) {
+				t.Errorf("var blocks = %q, want %q", blocks, tt.blocks)
+			}
+		})
+	}
+}
+
+func TestRewriteCollapsesEq(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Expr
+		want   string
+	}{
+		{
+			name: "or of eq on one predicate",
+			filter: newOr(
+				newComparison("eq", "customers.country", "$v0"),
+				newOr(newComparison("eq", "customers.country", "$v1"), newComparison("eq", "customers.city", "$v2")),
+				newComparison("eq", "customers.country", "$v3"),
+			),
+			want: "(eq(customers.country, [$v0, $v1, $v3]) OR eq(customers.city, $v2))",
+		},
+		{
+			name: "negated or",
+			filter: newNot(newOr(
+				newComparison("eq", "customers.country", "$v0"),
+				newComparison("eq", "customers.country", "$v1"),
+			)),
+			want: "NOT eq(customers.country, [$v0, $v1])",
+		},
+		{
+			// A node holds one country, so AND-ed values are not a list
+			name: "and of eq",
+			filter: newAnd(
+				newComparison("eq", "customers.country", "$v0"),
+				newComparison("eq", "customers.country", "$v1"),
+			),
+			want: "(eq(customers.country, $v0) AND eq(customers.country, $v1))",
+		},
+		{
+			name: "other functions",
+			filter: newOr(
+				newComparison("ge", "customers.age", "$v0"),
+				newComparison("ge", "customers.age", "$v1"),
+				&Comparison{Func: "eq", ValueVar: "var3", Args: []string{"$v2"}},
+				&Comparison{Func: "eq", ValueVar: "var3", Args: []string{"$v3"}},
+			),
+			want: "(ge(customers.age, $v0) OR ge(customers.age, $v1) OR eq(val(var3), $v2) OR eq(val(var3), $v3))",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PrintExpr(collapseEq(tt.filter)); got != tt.want {
+				t.Errorf("collapseEq = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteDedupesVarBlocks(t *testing.T) {
+	// $v0 and $v1 hold the same value, so var0 and var1 are the same block
+	query := &Query{
+		Type: "customers",
+		Filter: newAnd(
+			&VarRef{Name: "var0"},
+			newNot(&VarRef{Name: "var1"}),
+			&VarRef{Name: "var1"},
+			&Comparison{Func: "gt", ValueVar: "var3", Args: []string{"$v2"}},
+		),
+		Vars: []VarBlock{
+			traversal("var0", newComparison("eq", "subscriptions.status", "$v0"), "customers.subscriptions"),
+			traversal("var1", newComparison("eq", "subscriptions.status", "$v1"), "customers.subscriptions"),
+			{Type: "customers", Aggregate: &Aggregate{Var: "var2", Func: "count", Edge: "customers.purchases"}},
+			{Type: "customers", Aggregate: &Aggregate{Var: "var3", Func: "count", Edge: "customers.purchases"}},
+		},
+		Order:  []OrderKey{{ValueVar: "var3", Desc: true}},
+		Params: stringParams("active", "active", "5"),
+	}
+	rewriteQuery(query)
+
+	if got, want := PrintExpr(query.Filter), "(uid(var0) AND NOT uid(var0) AND gt(val(var2), $v2))"; got != want {
+		t.Errorf("filter = %s, want %s", got, want)
+	}
+	if got, want := varNames(query), []string{"var0", "var2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("var blocks = %q, want %q", got, want)
+	}
+	if got, want := query.Order, []OrderKey{{ValueVar: "var2", Desc: true}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("order = %+v, want %+v", got, want)
+	}
+	if got, want := paramNames(query), []string{"$v0", "$v2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("params = %q, want %q", got, want)
+	}
+}
+
+func TestRewriteKeepsDistinctVarBlocks(t *testing.T) {
+	// Same text, different values
+	query := &Query{
+		Type:   "customers",
+		Filter: newAnd(&VarRef{Name: "var0"}, &VarRef{Name: "var1"}),
+		Vars: []VarBlock{
+			traversal("var0", newComparison("eq", "subscriptions.status", "$v0"), "customers.subscriptions"),
+			traversal("var1", newComparison("eq", "subscriptions.status", "$v1"), "customers.subscriptions"),
+		},
+		Params: stringParams("active", "trial"),
+	}
+	rewriteQuery(query)
+
+	if got, want := varNames(query), []string{"var0", "var1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("var blocks = %q, want %q", got, want)
+	}
+	if got, want := paramNames(query), []string{"$v0", "$v1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("params = %q, want %q", got, want)
+	}
+}
+
+func TestRewriteDropsUnusedVarBlocks(t *testing.T) {
+	count := func(name, edge string, filter Expr) VarBlock {
+		return VarBlock{Type: "customers", Aggregate: &Aggregate{Var: name, Func: "count", Edge: edge, Filter: filter}}
+	}
+
+	// var1 and var4 lost their references, as when a macro or simplification
+	// removes the conditions using them
+	query := &Query{
+		Type:   "customers",
+		Root:   &VarRef{Name: "var5"},
+		Filter: newAnd(newComparison("type", "", "customers"), &VarRef{Name: "var0"}, &Comparison{Func: "ge", ValueVar: "var2", Args: []string{"$v2"}}),
+		Vars: []VarBlock{
+			traversal("var0", newComparison("eq", "subscriptions.status", "$v0"), "customers.subscriptions"),
+			traversal("var1", newComparison("eq", "subscriptions.package", "$v1"), "customers.subscriptions"),
+			count("var2", "customers.devices", nil),
+			count("var3", "customers.purchases", nil),
+			count("var4", "customers.purchases", newComparison("eq", "purchases.status", "$v3")),
+			traversal("var5", newComparison("gt", "devices.last_seen", "$v4"), "customers.devices"),
+		},
+		Order:  []OrderKey{{ValueVar: "var3", Desc: true}},
+		Params: stringParams("active", "Premium", "2", "paid", "2024-01-01"),
+	}
+	rewriteQuery(query)
+
+	if got, want := varNames(query), []string{"var0", "var2", "var3", "var5"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("var blocks = %q, want %q", got, want)
+	}
+	if got, want := paramNames(query), []string{"$v0", "$v2", "$v4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("params = %q, want %q", got, want)
+	}
+}
+
+func TestDropUnusedParams(t *testing.T) {
+	query := &Query{
+		Type:   "customers",
+		Root:   newComparison("eq", "customers.country", "$v0"),
+		Filter: newAnd(newComparison("type", "", "customers"), &VarRef{Name: "var0"}),
+		Vars: []VarBlock{
+			traversal("var0", newComparison("eq", "subscriptions.status", "$v2"), "customers.subscriptions"),
+			{Type: "customers", Aggregate: &Aggregate{
+				Var: "var1", Func: "count", Edge: "customers.purchases",
+				Filter: newComparison("eq", "purchases.status", "$v3"),
+			}},
+		},
+		Selection: Selection{
+			Fields: []string{"uid"},
+			Edges: []EdgeSelection{{
+				Edge:      "customers.subscriptions",
+				Selection: Selection{Edges: []EdgeSelection{{Edge: "subscriptions.plan", Filter: newComparison("eq", "plans.name", "$v5")}}},
+			}},
+		},
+		// $v1 and $v4 are bound but referenced nowhere
+		Params: stringParams("US", "unused", "active", "paid", "unused", "Gold"),
+	}
+	dropUnusedParams(query)
+
+	if got, want := paramNames(query), []string{"$v0", "$v2", "$v3", "$v5"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("params = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,94 @@
+package converter
+
+import "slices"
+
+// rangeFunctions are the inequality functions that can serve as a root function
+var rangeFunctions = []string{"ge", "le", "gt", "lt"}
+
+// chooseRoot replaces the type(X) root function with a more selective
+// condition when the main filter is a conjunction. Dgraph evaluates the root
+// function through an index and only applies @filter to the nodes it returns,
+// so a type() root visits every node of the type. Candidates are ranked:
+//
+//  1. eq on a predicate with an exact, hash or numeric/datetime index
+//  2. uid(varN) of a var block, whose nodes are already collected
+//  3. a range function on a predicate with an index that supports ranges
+//
+// The chosen condition moves to the root and type(X) moves into the filter.
+// Bool predicates are never chosen since eq on them splits the type in two.
+func (c *Converter) chooseRoot(query *Query) {
+	if query.Filter == nil {
+		return
+	}
+
+	conjuncts := flattenAnd(query.Filter)
+	best, bestRank := -1, 0
+
+	for i, conjunct := range conjuncts {
+		if rank := c.rootRank(conjunct); rank > 0 && (best < 0 || rank < bestRank) {
+			best, bestRank = i, rank
+		}
+	}
+	if best < 0 {
+		return
+	}
+
+	rest := append([]Expr{query.Root}, conjuncts[:best]...)
+	rest = append(rest, conjuncts[best+1:]...)
+
+	query.Root = conjuncts[best]
+	query.Filter = &BoolOp{Op: "AND", Operands: rest}
+}
+
+// rootRank returns the rank of a condition as a root function, 1 being the
+// most selective, or 0 when it cannot be used as one
+func (c *Converter) rootRank(expr Expr) int {
+	switch e := expr.(type) {
+	case *VarRef:
+		return 2
+
+	case *Comparison:
+		if e.Predicate == "" {
+			return 0
+		}
+		switch {
+		case e.Func == "eq" && c.indexSupports(e.Predicate, false):
+			return 1
+		case slices.Contains(rangeFunctions, e.Func) && c.indexSupports(e.Predicate, true):
+			return 3
+		}
+	}
+
+	return 0
+}
+
+// indexSupports reports whether a predicate has an index able to answer eq
+// or, when ranges is set, inequality functions
+func (c *Converter) indexSupports(predicate string, ranges bool) bool {
+	for _, tokenizer := range c.predicates[predicate].Indexes {
+		switch tokenizer {
+		case "exact", "int", "float", "year", "month", "day", "hour":
+			return true
+		case "hash":
+			if !ranges {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// flattenAnd returns the operands of nested conjunctions, so that
+// ((a AND b) AND c) yields a, b and c
+func flattenAnd(expr Expr) []Expr {
+	op, ok := expr.(*BoolOp)
+	if !ok || op.Op != "AND" {
+		return []Expr{expr}
+	}
+
+	var conjuncts []Expr
+	for _, operand := range op.Operands {
+		conjuncts = append(conjuncts, flattenAnd(operand)...)
+	}
+	return conjuncts
+}
@@ -0,0 +1,131 @@
+package converter
+
+import (
+	"testing"
+
+	models "github.com/shahariaz/user_segmentation/internal/model"
+)
+
+func TestChooseRoot(t *testing.T) {
+	c := NewConverter(WithPredicateSchema(map[string]models.PredicateSchema{
+		"customers.country":    {Type: "string", Indexes: []string{"exact"}},
+		"customers.city":       {Type: "string", Indexes: []string{"hash"}},
+		"customers.name":       {Type: "string", Indexes: []string{"term"}},
+		"customers.email":      {Type: "string"},
+		"customers.age":        {Type: "int", Indexes: []string{"int"}},
+		"customers.created_at": {Type: "datetime", Indexes: []string{"hour"}},
+		"customers.is_active":  {Type: "bool", Indexes: []string{"bool"}},
+	}))
+
+	country := newComparison("eq", "customers.country", "$v0")
+	city := newComparison("eq", "customers.city", "$v1")
+	age := newComparison("gt", "customers.age", "$v2")
+	block := &VarRef{Name: "var0"}
+
+	tests := []struct {
+		name   string
+		filter Expr
+		root   string
+		want   string
+	}{
+		{
+			name:   "indexed eq before a var block",
+			filter: newAnd(block, age, country),
+			root:   "eq(customers.country, $v0)",
+			want:   "(type(customers) AND uid(var0) AND gt(customers.age, $v2))",
+		},
+		{
+			name:   "var block before a range",
+			filter: newAnd(age, block),
+			root:   "uid(var0)",
+			want:   "(type(customers) AND gt(customers.age, $v2))",
+		},
+		{
+			name:   "range on an indexed predicate",
+			filter: newAnd(newComparison("eq", "customers.email", "$v3"), age),
+			root:   "gt(customers.age, $v2)",
+			want:   "(type(customers) AND eq(customers.email, $v3))",
+		},
+		{
+			name:   "range on a datetime index",
+			filter: newAnd(newComparison("ge", "customers.created_at", "$v3")),
+			root:   "ge(customers.created_at, $v3)",
+			want:   "type(customers)",
+		},
+		{
+			name:   "first of equally ranked conditions",
+			filter: newAnd(city, country),
+			root:   "eq(customers.city, $v1)",
+			want:   "(type(customers) AND eq(customers.country, $v0))",
+		},
+		{
+			name:   "nested conjunctions",
+			filter: newAnd(age, newAnd(newComparison("eq", "customers.email", "$v3"), country)),
+			root:   "eq(customers.country, $v0)",
+			want:   "(type(customers) AND gt(customers.age, $v2) AND eq(customers.email, $v3))",
+		},
+		{
+			name:   "range on a hash index",
+			filter: newComparison("gt", "customers.city", "$v1"),
+			root:   "type(customers)",
+			want:   "gt(customers.city, $v1)",
+		},
+		{
+			name:   "eq on a term index",
+			filter: newComparison("eq", "customers.name", "$v3"),
+			root:   "type(customers)",
+			want:   "eq(customers.name, $v3)",
+		},
+		{
+			name:   "unindexed predicate",
+			filter: newComparison("eq", "customers.email", "$v3"),
+			root:   "type(customers)",
+			want:   "eq(customers.email, $v3)",
+		},
+		{
+			// eq on a bool splits the type in two and narrows nothing
+			name:   "bool predicate",
+			filter: newComparison("eq", "customers.is_active", "$v3"),
+			root:   "type(customers)",
+			want:   "eq(customers.is_active, $v3)",
+		},
+		{
+			name:   "value variable",
+			filter: &Comparison{Func: "ge", ValueVar: "var1", Args: []string{"$v3"}},
+			root:   "type(customers)",
+			want:   "ge(val(var1), $v3)",
+		},
+		{
+			name:   "or at the top",
+			filter: newOr(country, city),
+			root:   "type(customers)",
+			want:   "(eq(customers.country, $v0) OR eq(customers.city, $v1))",
+		},
+		{
+			name:   "or among conjuncts",
+			filter: newAnd(newOr(country, block), newComparison("eq", "customers.email", "$v3")),
+			root:   "type(customers)",
+			want:   "((eq(customers.country, $v0) OR uid(var0)) AND eq(customers.email, $v3))",
+		},
+		{
+			name:   "negation",
+			filter: newAnd(newNot(country), newNot(block)),
+			root:   "type(customers)",
+			want:   "(NOT eq(customers.country, $v0) AND NOT uid(var0))",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := &Query{Type: "customers", Root: newComparison("type", "", "customers"), Filter: tt.filter}
+			c.chooseRoot(query)
+
+			if got := PrintExpr(query.Root); got != tt.root {
+				t.Errorf("root = %s, want %s", got, tt.root)
+			}
+			if got := PrintExpr(query.Filter); got != tt.want {
+				t.Errorf("filter = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
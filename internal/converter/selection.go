@@ -0,0 +1,156 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+
+	models "github.com/shahariaz/user_segmentation/internal/model"
+)
+
+// buildSelection translates the fields and related entities requested for an
+// entity. Fields are given by JSON name and translated through FieldMappings.
+func (c *Converter) buildSelection(selection *models.Selection, entityType string, path string, report *ValidationError, params *queryParams) Selection {
+	result := Selection{Fields: []string{"uid"}}
+
+	if len(selection.Fields) == 0 {
+		for _, field := range c.schema.DefaultFields[entityType] {
+			if field != "uid" {
+				result.Fields = append(result.Fields, field)
+			}
+		}
+	}
+
+	for i, field := range selection.Fields {
+		if field == "uid" {
+			continue
+		}
+
+		mapping := c.relationshipFieldMapping(field, entityType)
+		if mapping == nil {
+			report.add(joinPath(path, fmt.Sprintf("fields[%d]", i)), CodeUnknownField,
+				fmt.Sprintf("field %q is not a field of %q", field, entityType),
+				"select fields of the entity itself and use relations for related entities")
+			continue
+		}
+		if mapping.Computed != nil {
+			suggestion := ""
+			if source := c.sourceField(mapping); source != "" {
+				suggestion = fmt.Sprintf("select %s and derive the value from it", source)
+			}
+			report.add(joinPath(path, fmt.Sprintf("fields[%d]", i)), CodeUnsupportedOperand,
+				fmt.Sprintf("computed field %q cannot be selected", field), suggestion)
+			continue
+		}
+		result.Fields = append(result.Fields, mapping.DgraphField)
+	}
+
+	for i, relation := range selection.Relations {
+		relationPath := joinPath(path, fmt.Sprintf("relations[%d]", i))
+		if edge := c.buildRelationSelection(relation, entityType, relationPath, report, params); edge != nil {
+			result.Edges = append(result.Edges, *edge)
+		}
+	}
+
+	return result
+}
+
+// sourceField returns the JSON name of the stored field a computed field is
+// derived from, or "" when the source is not exposed as a field
+func (c *Converter) sourceField(mapping *models.FieldMapping) string {
+	for _, name := range c.fieldNames() {
+		for _, candidate := range c.schema.FieldMappings[name] {
+			if candidate.Computed == nil && candidate.DgraphField == mapping.DgraphField && candidate.EntityType == mapping.EntityType {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// buildRelationSelection translates a related entity into a nested block
+// with its own filter, ordering and limit. Like the main query it returns
+// the default page size when no limit is given.
+func (c *Converter) buildRelationSelection(relation models.RelationSelection, parentType string, path string, report *ValidationError, params *queryParams) *EdgeSelection {
+	if !c.isEntityType(relation.Entity) {
+		report.add(path+".entity", CodeUnknownEntity,
+			fmt.Sprintf("unknown entity type %q", relation.Entity),
+			"use one of: "+strings.Join(c.schema.EntityTypes, ", "))
+		return nil
+	}
+
+	edge := c.edgePredicate(parentType, relation.Entity)
+	if edge == "" {
+		report.add(path+".entity", CodeUnreachableEntity,
+			fmt.Sprintf("%q is not directly related to %q", relation.Entity, parentType),
+			"use one of: "+strings.Join(c.schema.Relationships[parentType], ", "))
+		return nil
+	}
+
+	limit := relation.Limit
+	if limit == 0 {
+		limit = c.pagination["default_limit"]
+	}
+	c.checkLimit(limit, path+".limit", report)
+	result := &EdgeSelection{
+		Edge:  edge,
+		First: limit,
+		Order: c.buildOrdering(relation.Sort, relation.Entity, path+".sort", report),
+	}
+	if relation.Filter != nil {
+		result.Filter = c.buildScopedCondition(*relation.Filter, relation.Entity, path+".filter", report, params)
+	}
+
+	nested := &models.Selection{Fields: relation.Fields, Relations: relation.Relations}
+	result.Selection = c.buildSelection(nested, relation.Entity, path, report, params)
+
+	return result
+}
+
+// buildOrdering translates sort keys into the ordering of a nested block
+func (c *Converter) buildOrdering(keys []models.SortKey, entityType, path string, report *ValidationError) []OrderKey {
+	var ordering []OrderKey
+
+	for i, key := range keys {
+		keyPath := fmt.Sprintf("%s[%d]", path, i)
+
+		if key.Aggregate != "" {
+			report.add(keyPath+".aggregate", CodeUnsupportedOperand,
+				"sorting by an aggregate is only supported on the main query", "")
+			continue
+		}
+
+		if orderKey, ok := c.buildSortKey(key, entityType, keyPath, report); ok {
+			ordering = append(ordering, orderKey)
+		}
+	}
+
+	return ordering
+}
+
+// buildSortKey translates a sort key on a field of the entity
+func (c *Converter) buildSortKey(key models.SortKey, entityType, path string, report *ValidationError) (OrderKey, bool) {
+	desc, ok := c.orderDirection(key.Direction, path, report)
+	if !ok {
+		return OrderKey{}, false
+	}
+
+	mapping := c.relationshipFieldMapping(key.Field, entityType)
+	if mapping == nil {
+		report.add(path+".field", CodeUnknownField,
+			fmt.Sprintf("field %q is not a field of %q", key.Field, entityType), "")
+		return OrderKey{}, false
+	}
+	if mapping.DataType == "array" || mapping.DataType == "complex" {
+		report.add(path+".field", CodeUnsupportedOperand,
+			fmt.Sprintf("cannot sort by %s field %q", mapping.DataType, key.Field),
+			"sort by a scalar field")
+		return OrderKey{}, false
+	}
+
+	// Values counted since a date grow as the date gets earlier
+	if mapping.Computed != nil && mapping.Computed.Direction == "since" {
+		desc = !desc
+	}
+
+	return OrderKey{Predicate: mapping.DgraphField, Desc: desc}, true
+}
@@ -0,0 +1,49 @@
+package converter
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestRelationSelectionLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  string
+		first  int
+		issues []string
+	}{
+		{name: "omitted", first: 100},
+		{name: "zero", limit: `,"limit":0`, first: 100},
+		{name: "given", limit: `,"limit":3`, first: 3},
+		{name: "maximum", limit: `,"limit":1000`, first: 1000},
+		{name: "above the maximum", limit: `,"limit":1001`, issues: []string{"select.relations[0].limit budget_exceeded"}},
+		{name: "negative", limit: `,"limit":-1`, issues: []string{"select.relations[0].limit invalid_value"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := `{"combine_with":"AND","groups":[],"select":{"fields":["name"],"relations":[` +
+				`{"entity":"purchases","fields":["purchase_amount"]` + tt.limit + `}]}}`
+
+			if tt.issues != nil {
+				var got []string
+				for _, issue := range validationIssues(t, query) {
+					got = append(got, fmt.Sprintf("%s %s", issue.Path, issue.Code))
+				}
+				if !reflect.DeepEqual(got, tt.issues) {
+					t.Errorf("issues = %q, want %q", got, tt.issues)
+				}
+				return
+			}
+
+			edges := buildQuery(t, query).Selection.Edges
+			if len(edges) != 1 {
+				t.Fatalf("got %d selected relations, want 1", len(edges))
+			}
+			if edges[0].First != tt.first {
+				t.Errorf("first = %d, want %d", edges[0].First, tt.first)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package converter
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	models "github.com/shahariaz/user_segmentation/internal/model"
+	"github.com/shahariaz/user_segmentation/internal/utils"
+)
+
+// simplifyQuery normalizes the filters of a query tree built from nested UI
+// groups: combinations nested in one using the same operator are flattened,
+// repeated operands removed and range comparisons of a predicate merged.
+func (c *Converter) simplifyQuery(query *Query) {
+	values := paramValues(query.Params)
+	simplify := func(expr Expr) Expr {
+		return c.mergeRanges(normalizeExpr(expr, values), values)
+	}
+
+	query.Filter = simplify(query.Filter)
+	for i := range query.Vars {
+		switch block := &query.Vars[i]; {
+		case block.Traversal != nil:
+			block.Traversal.Filter = simplify(block.Traversal.Filter)
+		case block.Aggregate != nil:
+			block.Aggregate.Filter = simplify(block.Aggregate.Filter)
+		}
+	}
+}
+
+// normalizeExpr flattens (a AND (b AND c)) into (a AND b AND c) and drops
+// operands equal to an earlier one of the same combination. Operands compare
+// by the values bound to their query variables.
+func normalizeExpr(expr Expr, values map[string]models.QueryParam) Expr {
+	switch e := expr.(type) {
+	case *Not:
+		return newNot(normalizeExpr(e.Operand, values))
+
+	case *BoolOp:
+		var operands []Expr
+		seen := make(map[string]bool)
+
+		add := func(operand Expr) {
+			key := exprKey(operand, values)
+			if !seen[key] {
+				seen[key] = true
+				operands = append(operands, operand)
+			}
+		}
+
+		for _, operand := range e.Operands {
+			operand = normalizeExpr(operand, values)
+			if nested, ok := operand.(*BoolOp); ok && nested.Op == e.Op {
+				for _, inner := range nested.Operands {
+					add(inner)
+				}
+				continue
+			}
+			add(operand)
+		}
+		return newBoolOp(e.Op, operands)
+	}
+
+	return expr
+}
+
+// mergeRanges keeps one lower and one upper bound per predicate in each
+// combination: the tightest under AND, so that gt(age, 30) AND ge(age, 40)
+// becomes ge(age, 40), and the loosest under OR.
+func (c *Converter) mergeRanges(expr Expr, values map[string]models.QueryParam) Expr {
+	switch e := expr.(type) {
+	case *Not:
+		return newNot(c.mergeRanges(e.Operand, values))
+
+	case *BoolOp:
+		operands := make([]Expr, 0, len(e.Operands))
+		for _, operand := range e.Operands {
+			operands = append(operands, c.mergeRanges(operand, values))
+		}
+
+		kept := make(map[string]int) // bound key to index in merged
+		var merged []Expr
+		for _, operand := range operands {
+			comparison, ok := operand.(*Comparison)
+			if !ok || !slices.Contains(rangeFunctions, comparison.Func) || len(comparison.Args) != 1 {
+				merged = append(merged, operand)
+				continue
+			}
+
+			key := comparisonTarget(comparison) + " " + boundSide(comparison.Func)
+			i, found := kept[key]
+			if !found {
+				kept[key] = len(merged)
+				merged = append(merged, operand)
+				continue
+			}
+
+			tighter, ok := c.tighterBound(merged[i].(*Comparison), comparison, values)
+			if !ok {
+				merged = append(merged, operand)
+				continue
+			}
+			if tighter == (e.Op == "AND") {
+				merged[i] = comparison
+			}
+		}
+		return newBoolOp(e.Op, merged)
+	}
+
+	return expr
+}
+
+// tighterBound reports whether next restricts more values than current, two
+// bounds on the same side of the same predicate. ok is false when their
+// values cannot be compared.
+func (c *Converter) tighterBound(current, next *Comparison, values map[string]models.QueryParam) (bool, bool) {
+	currentValue, currentBound := values[current.Args[0]]
+	nextValue, nextBound := values[next.Args[0]]
+	if !currentBound || !nextBound {
+		return false, false
+	}
+
+	dataType := currentValue.Type
+	if next.Predicate != "" {
+		dataType = c.predicates[next.Predicate].Type
+	}
+
+	order, ok := compareValues(nextValue.Value, currentValue.Value, dataType)
+	if !ok {
+		return false, false
+	}
+
+	if order == 0 {
+		// gt and lt exclude the bound itself
+		return next.Func == "gt" || next.Func == "lt", true
+	}
+	if boundSide(next.Func) == "lower" {
+		return order > 0, true
+	}
+	return order < 0, true
+}
+
+// comparisonTarget names what a comparison compares, a predicate or val(var)
+func comparisonTarget(comparison *Comparison) string {
+	if comparison.ValueVar != "" {
+		return "val(" + comparison.ValueVar + ")"
+	}
+	return comparison.Predicate
+}
+
+// boundSide returns "lower" for ge and gt and "upper" for le and lt
+func boundSide(function string) string {
+	if function == "ge" || function == "gt" {
+		return "lower"
+	}
+	return "upper"
+}
+
+// compareValues orders two raw values of a data type. ok is false when
+// either cannot be read as that type or the type has no order.
+func compareValues(a, b, dataType string) (int, bool) {
+	switch dataType {
+	case "int", "float":
+		x, errX := strconv.ParseFloat(a, 64)
+		y, errY := strconv.ParseFloat(b, 64)
+		if errX != nil || errY != nil {
+			return 0, false
+		}
+		return cmp.Compare(x, y), true
+
+	case "datetime":
+		x, okX := parseDatetime(a)
+		y, okY := parseDatetime(b)
+		if !okX || !okY {
+			return 0, false
+		}
+		return x.Compare(y), true
+
+	case "string":
+		return strings.Compare(a, b), true
+
+	case "version":
+		x, errX := utils.ParseVersion(a)
+		y, errY := utils.ParseVersion(b)
+		if errX != nil || errY != nil {
+			return 0, false
+		}
+		return x.Compare(y), true
+	}
+
+	return 0, false
+}
+
+// parseDatetime reads a datetime in any format accepted by Dgraph
+func parseDatetime(value string) (time.Time, bool) {
+	for _, layout := range datetimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// paramValues indexes query variables by name
+func paramValues(params []models.QueryParam) map[string]models.QueryParam {
+	values := make(map[string]models.QueryParam, len(params))
+	for _, param := range params {
+		values[param.Name] = param
+	}
+	return values
+}
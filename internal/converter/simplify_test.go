@@ -0,0 +1,187 @@
+package converter
+
+import (
+	"testing"
+
+	models "github.com/shahariaz/user_segmentation/internal/model"
+)
+
+// intParams returns int query variables $v0, $v1, ... with the values
+func intParams(values ...string) []models.QueryParam {
+	params := stringParams(values...)
+	for i := range params {
+		params[i].Type = "int"
+	}
+	return params
+}
+
+func TestSimplifyQuery(t *testing.T) {
+	age := func(function, arg string) Expr {
+		return newComparison(function, "customers.age", arg)
+	}
+	country := func(arg string) Expr {
+		return newComparison("eq", "customers.country", arg)
+	}
+
+	tests := []struct {
+		name   string
+		filter Expr
+		params []models.QueryParam
+		want   string
+	}{
+		{
+			name:   "nested and",
+			filter: newAnd(country("$v0"), newAnd(age("ge", "$v1"), newAnd(age("le", "$v2")))),
+			params: intParams("0", "18", "65"),
+			want:   "(eq(customers.country, $v0) AND ge(customers.age, $v1) AND le(customers.age, $v2))",
+		},
+		{
+			name:   "or nested in and",
+			filter: newAnd(country("$v0"), newOr(age("lt", "$v1"), age("gt", "$v2"))),
+			params: intParams("0", "18", "65"),
+			want:   "(eq(customers.country, $v0) AND (lt(customers.age, $v1) OR gt(customers.age, $v2)))",
+		},
+		{
+			name:   "nested or in negated or",
+			filter: newNot(newOr(country("$v0"), newOr(country("$v1"), country("$v2")))),
+			params: stringParams("US", "CA", "MX"),
+			want:   "NOT (eq(customers.country, $v0) OR eq(customers.country, $v1) OR eq(customers.country, $v2))",
+		},
+		{
+			// Duplicates compare by the values bound to their variables
+			name:   "duplicate operands",
+			filter: newAnd(country("$v0"), newAnd(country("$v1"), country("$v2"))),
+			params: stringParams("US", "US", "CA"),
+			want:   "(eq(customers.country, $v0) AND eq(customers.country, $v2))",
+		},
+		{
+			name:   "duplicate groups",
+			filter: newOr(newAnd(country("$v0"), age("gt", "$v1")), newAnd(country("$v2"), age("gt", "$v3"))),
+			params: stringParams("US", "30", "US", "30"),
+			want:   "(eq(customers.country, $v0) AND gt(customers.age, $v1))",
+		},
+		{
+			name:   "lower bounds under and",
+			filter: newAnd(age("gt", "$v0"), age("ge", "$v1")),
+			params: intParams("30", "40"),
+			want:   "ge(customers.age, $v1)",
+		},
+		{
+			name:   "lower bounds under or",
+			filter: newOr(age("gt", "$v0"), age("ge", "$v1")),
+			params: intParams("30", "40"),
+			want:   "gt(customers.age, $v0)",
+		},
+		{
+			name:   "upper bounds under and",
+			filter: newAnd(age("le", "$v0"), age("lt", "$v1"), country("$v2")),
+			params: intParams("65", "50", "0"),
+			want:   "(lt(customers.age, $v1) AND eq(customers.country, $v2))",
+		},
+		{
+			name:   "upper bounds under or",
+			filter: newOr(age("le", "$v0"), age("lt", "$v1")),
+			params: intParams("65", "50"),
+			want:   "le(customers.age, $v0)",
+		},
+		{
+			// gt excludes the bound that ge includes
+			name:   "exclusive lower bound under and",
+			filter: newAnd(age("ge", "$v0"), age("gt", "$v1")),
+			params: intParams("30", "30"),
+			want:   "gt(customers.age, $v1)",
+		},
+		{
+			name:   "inclusive lower bound under or",
+			filter: newOr(age("gt", "$v0"), age("ge", "$v1")),
+			params: intParams("30", "30"),
+			want:   "ge(customers.age, $v1)",
+		},
+		{
+			name:   "exclusive upper bound under and",
+			filter: newAnd(age("lt", "$v0"), age("le", "$v1")),
+			params: intParams("30", "30"),
+			want:   "lt(customers.age, $v0)",
+		},
+		{
+			name:   "inclusive upper bound under or",
+			filter: newOr(age("le", "$v0"), age("lt", "$v1")),
+			params: intParams("30", "30"),
+			want:   "le(customers.age, $v0)",
+		},
+		{
+			name:   "bounds on both sides",
+			filter: newAnd(age("ge", "$v0"), age("le", "$v1"), age("gt", "$v2"), age("lt", "$v3")),
+			params: intParams("18", "65", "21", "70"),
+			want:   "(gt(customers.age, $v2) AND le(customers.age, $v1))",
+		},
+		{
+			// NOT (age > 30 AND age >= 40) is NOT age >= 40
+			name:   "negated group",
+			filter: newNot(newAnd(age("gt", "$v0"), age("ge", "$v1"))),
+			params: intParams("30", "40"),
+			want:   "NOT ge(customers.age, $v1)",
+		},
+		{
+			name:   "negated or group",
+			filter: newAnd(country("$v0"), newNot(newOr(age("lt", "$v1"), age("lt", "$v2")))),
+			params: intParams("0", "18", "21"),
+			want:   "(eq(customers.country, $v0) AND NOT lt(customers.age, $v2))",
+		},
+		{
+			name: "value variables",
+			filter: newAnd(
+				&Comparison{Func: "ge", ValueVar: "var0", Args: []string{"$v0"}},
+				&Comparison{Func: "ge", ValueVar: "var0", Args: []string{"$v1"}},
+				&Comparison{Func: "ge", ValueVar: "var1", Args: []string{"$v2"}},
+			),
+			params: intParams("3", "5", "1"),
+			want:   "(ge(val(var0), $v1) AND ge(val(var1), $v2))",
+		},
+		{
+			// Ordered as datetimes rather than as text
+			name: "datetime bounds",
+			filter: newAnd(
+				newComparison("ge", "customers.created_at", "$v0"),
+				newComparison("ge", "customers.created_at", "$v1"),
+			),
+			params: stringParams("2024-06-01T00:00:00Z", "2024-01-15"),
+			want:   "ge(customers.created_at, $v0)",
+		},
+		{
+			name:   "values that cannot be compared",
+			filter: newAnd(age("gt", "$v0"), age("gt", "$v1")),
+			params: stringParams("thirty", "40"),
+			want:   "(gt(customers.age, $v0) AND gt(customers.age, $v1))",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := &Query{Filter: tt.filter, Params: tt.params}
+			NewConverter().simplifyQuery(query)
+
+			if got := PrintExpr(query.Filter); got != tt.want {
+				t.Errorf("filter = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSimplifyQueryVarBlocks(t *testing.T) {
+	query := &Query{
+		Vars: []VarBlock{traversal("var0", newAnd(
+			newComparison("ge", "subscriptions.price", "$v0"),
+			newAnd(newComparison("ge", "subscriptions.price", "$v1")),
+		), "customers.subscriptions")},
+		Params: []models.QueryParam{
+			{Name: "$v0", Type: "float", Value: "9.99"},
+			{Name: "$v1", Type: "float", Value: "19.5"},
+		},
+	}
+	NewConverter().simplifyQuery(query)
+
+	if got, want := PrintExpr(query.Vars[0].Traversal.Filter), "ge(subscriptions.price, $v1)"; got != want {
+		t.Errorf("var block filter = %s, want %s", got, want)
+	}
+}
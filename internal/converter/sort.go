@@ -0,0 +1,65 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+
+	models "github.com/shahariaz/user_segmentation/internal/model"
+)
+
+// buildMainOrdering translates the sort keys of the main query. Keys on an
+// aggregate are computed into a value variable by an extra var block and
+// ordered by val().
+func (c *Converter) buildMainOrdering(keys []models.SortKey, mainEntityType string, varCounter int, report *ValidationError, params *queryParams) ([]OrderKey, []VarBlock, int) {
+	var variables []VarBlock
+	var ordering []OrderKey
+
+	for i, key := range keys {
+		keyPath := fmt.Sprintf("sort[%d]", i)
+
+		if key.Aggregate == "" {
+			if orderKey, ok := c.buildSortKey(key, mainEntityType, keyPath, report); ok {
+				ordering = append(ordering, orderKey)
+			}
+			continue
+		}
+
+		desc, ok := c.orderDirection(key.Direction, keyPath, report)
+		if !ok {
+			continue
+		}
+
+		spec := aggregateSpec{
+			aggregate:    key.Aggregate,
+			relationship: key.Relationship,
+			field:        key.Field,
+			where:        key.Where,
+		}
+
+		var aggregateVar string
+		var block *VarBlock
+		aggregateVar, _, block, varCounter = c.buildAggregateBlock(spec, mainEntityType, varCounter, keyPath, report, params)
+		if block == nil {
+			continue
+		}
+
+		variables = append(variables, *block)
+		ordering = append(ordering, OrderKey{ValueVar: aggregateVar, Desc: desc})
+	}
+
+	return ordering, variables, varCounter
+}
+
+// orderDirection reports whether a sort direction is descending
+func (c *Converter) orderDirection(direction, path string, report *ValidationError) (bool, bool) {
+	switch strings.ToLower(direction) {
+	case "", "asc":
+		return false, true
+	case "desc":
+		return true, true
+	}
+
+	report.add(path+".direction", CodeInvalidValue,
+		fmt.Sprintf("unknown sort direction %q", direction), `use "asc" or "desc"`)
+	return false, false
+}
@@ -0,0 +1,95 @@
+package converter
+
+import (
+	"slices"
+	"strings"
+
+	models "github.com/shahariaz/user_segmentation/internal/model"
+)
+
+// hubEntityType is the entity queries are rooted at when no target entity is given
+const hubEntityType = "customers"
+
+// edgePredicate returns the predicate that leads from one entity to a directly
+// related one. Child edges use the forward predicate and parent edges use the
+// reverse predicate from config.GetReversePredicates.
+func (c *Converter) edgePredicate(from, to string) string {
+	if !slices.Contains(c.schema.Relationships[from], to) {
+		return ""
+	}
+
+	// "~customers.devices" is the reverse of the customers -> devices edge
+	if reverse, ok := c.reversePredicates[to]; ok && strings.HasPrefix(reverse, "~"+from+".") {
+		return strings.TrimPrefix(reverse, "~")
+	}
+	if reverse, ok := c.reversePredicates[from]; ok && strings.HasPrefix(reverse, "~"+to+".") {
+		return reverse
+	}
+
+	return ""
+}
+
+// relationshipPath returns the edge predicates to follow from the root entity
+// to the target entity, or nil when the target cannot be reached. The path is
+// the shortest one through the relationship graph, so contents are reached
+// from customers via customers.watch_histories and watch_histories.content.
+func (c *Converter) relationshipPath(root, target string) []string {
+	if root == target {
+		return nil
+	}
+
+	// Breadth-first search keeping the predicate path to every visited entity
+	paths := map[string][]string{root: {}}
+	queue := []string{root}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, next := range c.schema.Relationships[current] {
+			if _, visited := paths[next]; visited {
+				continue
+			}
+
+			predicate := c.edgePredicate(current, next)
+			if predicate == "" {
+				continue
+			}
+
+			path := append(slices.Clone(paths[current]), predicate)
+			if next == target {
+				return path
+			}
+
+			paths[next] = path
+			queue = append(queue, next)
+		}
+	}
+
+	return nil
+}
+
+// resolveMapping picks the mapping of a field to evaluate from the root entity.
+// A mapping on the root itself wins, otherwise the one with the shortest path.
+func (c *Converter) resolveMapping(mappings []models.FieldMapping, root string) (*models.FieldMapping, []string) {
+	var best *models.FieldMapping
+	var bestPath []string
+
+	for i := range mappings {
+		if mappings[i].EntityType == root {
+			return &mappings[i], nil
+		}
+
+		path := c.relationshipPath(root, mappings[i].EntityType)
+		if path != nil && (best == nil || len(path) < len(bestPath)) {
+			best = &mappings[i]
+			bestPath = path
+		}
+	}
+
+	return best, bestPath
+}
+
+func (c *Converter) isEntityType(entityType string) bool {
+	return slices.Contains(c.schema.EntityTypes, entityType)
+}
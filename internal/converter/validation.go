@@ -0,0 +1,364 @@
+package converter
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	models "github.com/shahariaz/user_segmentation/internal/model"
+	"github.com/shahariaz/user_segmentation/internal/utils"
+)
+
+// Reason codes reported in a ValidationIssue
+const (
+	CodeUnknownField       = "unknown_field"
+	CodeUnknownOperator    = "unknown_operator"
+	CodeInvalidValue       = "invalid_value"
+	CodeInvalidCombinator  = "invalid_combinator"
+	CodeUnreachableEntity  = "unreachable_entity"
+	CodeUnknownEntity      = "unknown_entity"
+	CodeInvalidScope       = "invalid_scope"
+	CodeUnsupportedOperand = "unsupported_operand"
+)
+
+// datetimeLayouts lists the datetime formats accepted by Dgraph
+var datetimeLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// ValidationIssue describes a single problem found in a JSON query
+type ValidationIssue struct {
+	Path       string `json:"path"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+// ValidationError is returned by ConvertToDQL when the JSON query contains
+// filters that cannot be converted faithfully
+type ValidationError struct {
+	Issues []ValidationIssue `json:"issues"`
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Issues) == 1 {
+		return fmt.Sprintf("invalid query: %s: %s", e.Issues[0].Path, e.Issues[0].Message)
+	}
+	return fmt.Sprintf("invalid query: %d validation issues", len(e.Issues))
+}
+
+func (e *ValidationError) add(path, code, message, suggestion string) {
+	e.Issues = append(e.Issues, ValidationIssue{
+		Path:       path,
+		Code:       code,
+		Message:    message,
+		Suggestion: suggestion,
+	})
+}
+
+func (e *ValidationError) hasIssues() bool {
+	return len(e.Issues) > 0
+}
+
+// validateCombinator reports combine_with values other than AND and OR. An
+// omitted combinator means AND.
+func (c *Converter) validateCombinator(combineWith, path string, report *ValidationError) {
+	switch strings.ToUpper(combineWith) {
+	case "", "AND", "OR":
+		return
+	}
+	report.add(joinPath(path, "combine_with"), CodeInvalidCombinator,
+		fmt.Sprintf("unsupported combinator %q", combineWith),
+		`use "AND" or "OR"`)
+}
+
+// validateFilter checks the field, operator and value of a filter and reports
+// every problem found. It returns false when the filter cannot be converted.
+func (c *Converter) validateFilter(filter models.Filter, path string, report *ValidationError) bool {
+	valid := true
+
+	mappings, exists := c.schema.FieldMappings[filter.Field]
+	if !exists {
+		suggestion := "use one of the fields defined in the schema configuration"
+		if match := utils.ClosestMatch(filter.Field, c.fieldNames(), 3); match != "" {
+			suggestion = fmt.Sprintf("did you mean %q?", match)
+		}
+		report.add(path+".field", CodeUnknownField,
+			fmt.Sprintf("unknown field %q", filter.Field), suggestion)
+		valid = false
+	}
+
+	if _, exists := c.operators[filter.Op]; !exists {
+		suggestion := "supported operators: " + strings.Join(c.operatorNames(), ", ")
+		// Symbolic operators are too short for edit distance to be meaningful
+		if match := utils.ClosestMatch(filter.Op, c.operatorNames(), 2); len(filter.Op) > 2 && match != "" {
+			suggestion = fmt.Sprintf("did you mean %q?", match)
+		}
+		report.add(path+".op", CodeUnknownOperator,
+			fmt.Sprintf("unknown operator %q", filter.Op), suggestion)
+		return false
+	}
+
+	if !exists {
+		return false
+	}
+
+	return c.validateValue(filter, mappings[0].DataType, path+".value", report) && valid
+}
+
+// validateValue checks that the filter value has the shape required by the
+// operator and that each operand matches the field's data type
+func (c *Converter) validateValue(filter models.Filter, dataType, path string, report *ValidationError) bool {
+	switch filter.Op {
+	case "IS_NULL", "IS_NOT_NULL":
+		return true
+
+	case "IN", "NOT_IN":
+		switch v := filter.Value.(type) {
+		case []interface{}:
+			if len(v) == 0 {
+				report.add(path, CodeInvalidValue,
+					fmt.Sprintf("operator %q requires at least one value", filter.Op),
+					`provide a non-empty list such as ["a", "b"]`)
+				return false
+			}
+			valid := true
+			for i, item := range v {
+				if !c.validateOperand(item, dataType, fmt.Sprintf("%s[%d]", path, i), report) {
+					valid = false
+				}
+			}
+			return valid
+		case map[string]interface{}:
+			if filter.Op == "IN" && dataType == "complex" {
+				return true
+			}
+			report.add(path, CodeInvalidValue,
+				fmt.Sprintf("operator %q does not accept an object for field %q", filter.Op, filter.Field),
+				`provide a list such as ["a", "b"]`)
+			return false
+		default:
+			return c.validateOperand(v, dataType, path, report)
+		}
+
+	case "CONTAINS_ANY", "CONTAINS_ALL", "CONTAINS_NONE":
+		if dataType != "array" {
+			report.add(path, CodeUnsupportedOperand,
+				fmt.Sprintf("operator %q requires a list field, %q is %s", filter.Op, filter.Field, dataType),
+				`use "IN" or "NOT_IN" to match single-valued fields`)
+			return false
+		}
+		values, ok := filter.Value.([]interface{})
+		if !ok {
+			return c.validateListElement(filter.Value, path, report)
+		}
+		if len(values) == 0 {
+			report.add(path, CodeInvalidValue,
+				fmt.Sprintf("operator %q requires at least one value", filter.Op),
+				`provide a non-empty list such as ["Action", "Comedy"]`)
+			return false
+		}
+		valid := true
+		for i, item := range values {
+			if !c.validateListElement(item, fmt.Sprintf("%s[%d]", path, i), report) {
+				valid = false
+			}
+		}
+		return valid
+
+	case "BETWEEN":
+		switch v := filter.Value.(type) {
+		case []interface{}:
+			if len(v) != 2 {
+				report.add(path, CodeInvalidValue,
+					fmt.Sprintf("operator %q requires exactly two values, got %d", filter.Op, len(v)),
+					"provide [min, max]")
+				return false
+			}
+			minValid := c.validateOperand(v[0], dataType, path+"[0]", report)
+			maxValid := c.validateOperand(v[1], dataType, path+"[1]", report)
+			return minValid && maxValid
+		case map[string]interface{}:
+			minVal, hasMin := v["min"]
+			maxVal, hasMax := v["max"]
+			if !hasMin || !hasMax {
+				report.add(path, CodeInvalidValue,
+					fmt.Sprintf("operator %q requires both min and max", filter.Op),
+					`provide {"min": ..., "max": ...}`)
+				return false
+			}
+			minValid := c.validateOperand(minVal, dataType, path+".min", report)
+			maxValid := c.validateOperand(maxVal, dataType, path+".max", report)
+			return minValid && maxValid
+		default:
+			report.add(path, CodeInvalidValue,
+				fmt.Sprintf("operator %q requires a range", filter.Op),
+				`provide [min, max] or {"min": ..., "max": ...}`)
+			return false
+		}
+
+	case "LIKE", "ILIKE", "CONTAINS", "REGEX", "STARTS_WITH", "ENDS_WITH":
+		str, ok := filter.Value.(string)
+		if !ok || str == "" {
+			report.add(path, CodeInvalidValue,
+				fmt.Sprintf("operator %q requires a non-empty string", filter.Op),
+				"provide the text to match as a string")
+			return false
+		}
+		if filter.Op == "REGEX" {
+			if _, err := regexp.Compile(str); err != nil {
+				report.add(path, CodeInvalidValue,
+					fmt.Sprintf("invalid regular expression: %v", err), "")
+				return false
+			}
+		}
+		if dataType != "string" && dataType != "array" {
+			report.add(path, CodeUnsupportedOperand,
+				fmt.Sprintf("operator %q cannot be used on %s field %q", filter.Op, dataType, filter.Field),
+				"use a comparison operator such as = or BETWEEN")
+			return false
+		}
+		return true
+
+	case "VERSION_RANGE":
+		return c.validateVersion(filter, path, report)
+
+	default:
+		if _, isVersionField := c.versionFields[filter.Field]; isVersionField && filter.Aggregate == "" {
+			return c.validateVersion(filter, path, report)
+		}
+		if _, isRelative := relativeDateExpression(filter.Value); isRelative && dataType == "datetime" {
+			return c.validateOperand(filter.Value, dataType, path, report)
+		}
+		switch filter.Value.(type) {
+		case []interface{}, map[string]interface{}:
+			report.add(path, CodeInvalidValue,
+				fmt.Sprintf("operator %q requires a single value", filter.Op),
+				`use "IN" to match any of several values`)
+			return false
+		}
+		return c.validateOperand(filter.Value, dataType, path, report)
+	}
+}
+
+// validateOperand checks a single scalar value against a field data type
+func (c *Converter) validateOperand(value interface{}, dataType, path string, report *ValidationError) bool {
+	if value == nil {
+		report.add(path, CodeInvalidValue, "value must not be null",
+			`use "IS_NULL" to match missing values`)
+		return false
+	}
+
+	if expr, isRelative := relativeDateExpression(value); isRelative && dataType == "datetime" {
+		if _, err := utils.ResolveRelativeDate(expr, c.now()); err != nil {
+			report.add(path, CodeInvalidValue, err.Error(),
+				`use an anchor such as "now" or "start_of_month" followed by offsets such as "-30d"`)
+			return false
+		}
+		return true
+	}
+
+	switch value.(type) {
+	case []interface{}, map[string]interface{}:
+		report.add(path, CodeInvalidValue, "expected a single value, got a list or object", "")
+		return false
+	}
+
+	switch dataType {
+	case "int":
+		switch v := value.(type) {
+		case float64:
+			if v == math.Trunc(v) {
+				return true
+			}
+		case string:
+			if _, err := strconv.Atoi(v); err == nil {
+				return true
+			}
+		}
+		report.add(path, CodeInvalidValue,
+			fmt.Sprintf("expected an integer, got %v", value), "provide a whole number")
+		return false
+
+	case "float":
+		switch v := value.(type) {
+		case float64:
+			return true
+		case string:
+			if _, err := strconv.ParseFloat(v, 64); err == nil {
+				return true
+			}
+		}
+		report.add(path, CodeInvalidValue,
+			fmt.Sprintf("expected a number, got %v", value), "provide a numeric value")
+		return false
+
+	case "bool":
+		if _, ok := value.(bool); ok {
+			return true
+		}
+		report.add(path, CodeInvalidValue,
+			fmt.Sprintf("expected a boolean, got %v", value), "use true or false")
+		return false
+
+	case "datetime":
+		if str, ok := value.(string); ok {
+			for _, layout := range datetimeLayouts {
+				if _, err := time.Parse(layout, str); err == nil {
+					return true
+				}
+			}
+		}
+		report.add(path, CodeInvalidValue,
+			fmt.Sprintf("expected a datetime, got %v", value),
+			`use RFC 3339 such as "2024-01-31T00:00:00Z", a date such as "2024-01-31" or a relative date such as "now-30d"`)
+		return false
+	}
+
+	return true
+}
+
+// validateListElement checks a value matched against the elements of a [string] predicate
+func (c *Converter) validateListElement(value interface{}, path string, report *ValidationError) bool {
+	if _, ok := value.(string); ok {
+		return true
+	}
+	report.add(path, CodeInvalidValue,
+		fmt.Sprintf("expected a string list element, got %v", value), "")
+	return false
+}
+
+func (c *Converter) fieldNames() []string {
+	names := make([]string, 0, len(c.schema.FieldMappings))
+	for name := range c.schema.FieldMappings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *Converter) operatorNames() []string {
+	names := make([]string, 0, len(c.operators))
+	for name := range c.operators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// joinPath appends a key to a JSON path, omitting the separator at the root
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
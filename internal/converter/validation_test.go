@@ -0,0 +1,48 @@
+package converter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCombinators(t *testing.T) {
+	tests := []struct {
+		name       string
+		combinator string
+		conditions []string
+	}{
+		{
+			name:       "omitted",
+			conditions: []string{`eq(customers.country, "US")`, `eq(customers.city, "NYC")`},
+		},
+		{
+			name:       "lower case and",
+			combinator: `"combine_with":"and",`,
+			conditions: []string{`eq(customers.country, "US")`, `eq(customers.city, "NYC")`},
+		},
+		{
+			name:       "or",
+			combinator: `"combine_with":"OR",`,
+			conditions: []string{`(eq(customers.country, "US") OR eq(customers.city, "NYC"))`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := buildQuery(t, `{"combine_with":"AND","groups":[{`+tt.combinator+
+				`"filters":[{"field":"country","op":"=","value":"US"},{"field":"city","op":"=","value":"NYC"}]}]}`)
+
+			if got := conditions(query); !reflect.DeepEqual(got, tt.conditions) {
+				t.Errorf("conditions = %q, want %q", got, tt.conditions)
+			}
+		})
+	}
+}
+
+func TestInvalidCombinator(t *testing.T) {
+	issues := validationIssues(t, `{"combine_with":"AND","groups":[{"combine_with":"XOR","filters":[{"field":"country","op":"=","value":"US"}]}]}`)
+
+	if len(issues) != 1 || issues[0].Path != "groups[0].combine_with" || issues[0].Code != CodeInvalidCombinator {
+		t.Errorf("issues = %+v, want one invalid_combinator at groups[0].combine_with", issues)
+	}
+}
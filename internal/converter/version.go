@@ -0,0 +1,147 @@
+package converter
+
+import (
+	"fmt"
+	"strconv"
+
+	models "github.com/shahariaz/user_segmentation/internal/model"
+	"github.com/shahariaz/user_segmentation/internal/utils"
+)
+
+// versionFunctions maps range comparator operators to DQL functions
+var versionFunctions = map[string]string{
+	"=":  "eq",
+	">":  "gt",
+	">=": "ge",
+	"<":  "lt",
+	"<=": "le",
+}
+
+// buildVersionComparisonCondition compares a version field through its
+// <predicate>_numeric companion, which orders versions numerically. Stored
+// pre-releases compare correctly with a release operand; pre-release operands
+// are rejected by validateVersion since they all share a numeric value.
+func (c *Converter) buildVersionComparisonCondition(params *queryParams, mapping *models.FieldMapping, filter models.Filter, dqlFunction string) Expr {
+	versionStr, ok := filter.Value.(string)
+	if !ok {
+		return nil
+	}
+
+	version, err := utils.ParseVersion(versionStr)
+	if err != nil || len(version.Prerelease) > 0 {
+		return nil
+	}
+	numericVersion, err := version.Numeric()
+	if err != nil {
+		return nil
+	}
+
+	numericField := mapping.DgraphField + "_numeric"
+	value := params.bind(strconv.FormatInt(numericVersion, 10), "int")
+	if filter.Op == "!=" {
+		return newNot(newComparison("eq", numericField, value))
+	}
+	return newComparison(dqlFunction, numericField, value)
+}
+
+// buildVersionRangeCondition compiles an npm-style range into comparisons on
+// the numeric version predicate, one AND-ed set per "||" alternative. As in
+// npm, a pre-release only satisfies a set naming a pre-release of the same
+// version. Ranges naming pre-releases are rejected, so every set excludes the
+// nodes flagged by <predicate>_prerelease and ">=5.0 <6" skips 5.1.0-beta.
+func (c *Converter) buildVersionRangeCondition(params *queryParams, mapping *models.FieldMapping, filter models.Filter) Expr {
+	expr, ok := filter.Value.(string)
+	if !ok {
+		return nil
+	}
+
+	versionRange, err := utils.ParseVersionRange(expr)
+	if err != nil {
+		return nil
+	}
+
+	numericField := mapping.DgraphField + "_numeric"
+	release := newNot(newComparison("has", mapping.DgraphField+"_prerelease"))
+	var alternatives []Expr
+
+	for _, set := range versionRange {
+		if len(set) == 0 {
+			alternatives = append(alternatives, newAnd(newComparison("has", numericField), release))
+			continue
+		}
+
+		var conditions []Expr
+		for _, comparator := range set {
+			if comparator.NamesPrerelease() {
+				return nil
+			}
+			numericVersion, err := comparator.Version.Numeric()
+			if err != nil {
+				return nil
+			}
+			value := params.bind(strconv.FormatInt(numericVersion, 10), "int")
+			conditions = append(conditions, newComparison(versionFunctions[comparator.Op], numericField, value))
+		}
+		alternatives = append(alternatives, newAnd(append(conditions, release)...))
+	}
+
+	return newOr(alternatives...)
+}
+
+// validateVersion checks version comparison and range values on version fields
+func (c *Converter) validateVersion(filter models.Filter, path string, report *ValidationError) bool {
+	if _, isVersionField := c.versionFields[filter.Field]; !isVersionField {
+		if filter.Op == "VERSION_RANGE" {
+			report.add(path, CodeUnsupportedOperand,
+				fmt.Sprintf("operator %q requires a version field, %q is not one", filter.Op, filter.Field),
+				"use VERSION_RANGE on app_version or os_version")
+			return false
+		}
+		return true
+	}
+
+	str, ok := filter.Value.(string)
+	if !ok {
+		report.add(path, CodeInvalidValue,
+			fmt.Sprintf("version field %q requires a version string, got %v", filter.Field, filter.Value),
+			`provide a version such as "5.2.0"`)
+		return false
+	}
+
+	if filter.Op == "VERSION_RANGE" {
+		versionRange, err := utils.ParseVersionRange(str)
+		if err != nil {
+			report.add(path, CodeInvalidValue, err.Error(),
+				`use a range such as "^5.2", "~1.4.0" or ">=5.0 <6"`)
+			return false
+		}
+		for _, set := range versionRange {
+			for _, comparator := range set {
+				if comparator.NamesPrerelease() {
+					report.add(path, CodeUnsupportedOperand,
+						fmt.Sprintf("version range %q names pre-release %s", str, comparator.Version),
+						"bound the range with release versions such as 5.2.0")
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	version, err := utils.ParseVersion(str)
+	if err == nil {
+		_, err = version.Numeric()
+	}
+	if err != nil {
+		report.add(path, CodeInvalidValue, err.Error(), `provide a version such as "5.2.0"`)
+		return false
+	}
+	// Pre-releases of a version share one numeric value and cannot be told apart
+	if len(version.Prerelease) > 0 {
+		report.add(path, CodeUnsupportedOperand,
+			fmt.Sprintf("cannot compare version field %q with pre-release %s", filter.Field, version),
+			fmt.Sprintf(`compare with a release such as "%d.%d.%d"`, version.Major, version.Minor, version.Patch))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,78 @@
+package converter
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestVersionFilters(t *testing.T) {
+	tests := []struct {
+		op         string
+		value      string
+		conditions []string
+	}{
+		{">", "5.2", []string{`gt(customers.app_version_numeric, "50000020000001")`}},
+		{"!=", "5.2.0+build.7", []string{`NOT eq(customers.app_version_numeric, "50000020000001")`}},
+		{
+			// Pre-releases only satisfy ranges naming one, as in npm
+			"VERSION_RANGE", ">=5.0 <6",
+			[]string{
+				`ge(customers.app_version_numeric, "50000000000001")`,
+				`lt(customers.app_version_numeric, "60000000000000")`,
+				`NOT has(customers.app_version_prerelease)`,
+			},
+		},
+		{
+			"VERSION_RANGE", "~1.4.0 || *",
+			[]string{
+				`((ge(customers.app_version_numeric, "10000040000001") AND lt(customers.app_version_numeric, "10000050000000") AND NOT has(customers.app_version_prerelease)) OR ` +
+					`(has(customers.app_version_numeric) AND NOT has(customers.app_version_prerelease)))`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.op+" "+tt.value, func(t *testing.T) {
+			query := buildQuery(t, fmt.Sprintf(`{
+				"combine_with": "AND",
+				"groups": [{"combine_with": "AND", "filters": [
+					{"field": "app_version", "op": %q, "value": %q}
+				]}]
+			}`, tt.op, tt.value))
+
+			if got := conditions(query); !reflect.DeepEqual(got, tt.conditions) {
+				t.Errorf("conditions = %q, want %q", got, tt.conditions)
+			}
+		})
+	}
+}
+
+func TestVersionFiltersRejectPrereleaseOperands(t *testing.T) {
+	// Pre-releases of a version share one numeric value, so comparing with
+	// one would match its siblings
+	for _, filter := range []string{
+		`{"field": "app_version", "op": ">", "value": "5.2.0-beta.1"}`,
+		`{"field": "app_version", "op": "=", "value": "5.2.0-beta.1"}`,
+		`{"field": "os_version", "op": "VERSION_RANGE", "value": "^5.2.0-beta.1"}`,
+		`{"field": "os_version", "op": "VERSION_RANGE", "value": ">=5.0.0-0 <6"}`,
+	} {
+		issues := validationIssues(t, `{
+			"combine_with": "AND",
+			"groups": [{"combine_with": "AND", "filters": [`+filter+`]}]
+		}`)
+
+		if len(issues) != 1 || issues[0].Code != CodeUnsupportedOperand {
+			t.Errorf("%s: issues = %+v, want one %s issue", filter, issues, CodeUnsupportedOperand)
+		}
+	}
+}
+
+func TestVersionFieldsHaveMappings(t *testing.T) {
+	c := NewConverter()
+	for field := range c.versionFields {
+		if len(c.schema.FieldMappings[field]) == 0 {
+			t.Errorf("version field %q has no field mapping", field)
+		}
+	}
+}
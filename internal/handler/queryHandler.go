@@ -2,19 +2,37 @@ package handler
 
 import (
 	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/shahariaz/user_segmentation/dgraph"
+	"github.com/shahariaz/user_segmentation/internal/config"
 	"github.com/shahariaz/user_segmentation/internal/converter"
 	models "github.com/shahariaz/user_segmentation/internal/model"
 )
 
+// apiKeyHeader carries the API key of a client with its own complexity budget.
+// Requests without it get the default budget.
+const apiKeyHeader = "X-API-Key"
+
 type QueryHandler struct {
 	converter    *converter.Converter
 	dgraphClient *dgraph.Client
+	// clients enforce the complexity budgets of the API clients with a key
+	clients []apiClient
+}
+
+// apiClient is an API client authenticated by its key
+type apiClient struct {
+	key       string
+	converter *converter.Converter
 }
 
 func NewQueryHandler() *QueryHandler {
@@ -26,11 +44,81 @@ func NewQueryHandler() *QueryHandler {
 		fmt.Println("💡 To use /execute endpoint, start Dgraph with: docker-compose up -d")
 	}
 
+	predicates := converter.WithPredicateSchema(loadPredicateSchema(dgraphClient))
+
+	var clients []apiClient
+	for name, client := range config.GetAPIClients() {
+		key := os.Getenv(client.KeyEnv)
+		if key == "" {
+			log.Printf("⚠️ %s is not set, API client %q is disabled", client.KeyEnv, name)
+			continue
+		}
+		clients = append(clients, apiClient{
+			key:       key,
+			converter: converter.NewConverter(converter.WithBudget(client.Budget), predicates),
+		})
+	}
+
 	return &QueryHandler{
-		converter: converter.NewConverter(),
+		converter: converter.NewConverter(predicates),
 
 		dgraphClient: dgraphClient,
+		clients:      clients,
+	}
+}
+
+// loadPredicateSchema reads the predicate indexes of the connected Dgraph, so
+// that operators are checked against the indexes that actually exist. It falls
+// back to the bundled schema when Dgraph is unavailable or has no schema yet.
+func loadPredicateSchema(client *dgraph.Client) map[string]models.PredicateSchema {
+	if client == nil {
+		return config.GetPredicateSchema()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	response, err := client.ExecuteDQL(ctx, "schema {}")
+	if err != nil {
+		log.Printf("⚠️ Could not introspect the Dgraph schema, using the bundled one: %v", err)
+		return config.GetPredicateSchema()
+	}
+
+	data, err := json.Marshal(response.Data)
+	if err != nil {
+		return config.GetPredicateSchema()
+	}
+
+	predicates, err := config.ParseSchemaIntrospection(data)
+	if err != nil {
+		log.Printf("⚠️ Could not read the Dgraph schema, using the bundled one: %v", err)
+		return config.GetPredicateSchema()
+	}
+	if len(predicates) == 0 {
+		log.Printf("⚠️ Dgraph has no schema yet, using the bundled one")
+		return config.GetPredicateSchema()
 	}
+
+	return predicates
+}
+
+// converterFor returns the converter enforcing the calling client's budget:
+// the default one without an API key, or the budget of the client the key
+// belongs to. An unknown key is answered with 401 and false.
+func (h *QueryHandler) converterFor(c *gin.Context) (*converter.Converter, bool) {
+	key := c.GetHeader(apiKeyHeader)
+	if key == "" {
+		return h.converter, true
+	}
+
+	for _, client := range h.clients {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(client.key)) == 1 {
+			return client.converter, true
+		}
+	}
+
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Unknown API key"})
+	return nil, false
 }
 
 func (h *QueryHandler) HandleQuery(c *gin.Context) {
@@ -40,12 +128,13 @@ func (h *QueryHandler) HandleQuery(c *gin.Context) {
 		return
 	}
 
-	dqlQuery, err := h.converter.ConvertToDQL(&jsonQuery)
+	conv, ok := h.converterFor(c)
+	if !ok {
+		return
+	}
+	dqlQuery, err := conv.ConvertToDQL(&jsonQuery)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to convert query",
-			"details": err.Error(),
-		})
+		respondConversionError(c, err)
 		return
 	}
 
@@ -58,40 +147,242 @@ func (h *QueryHandler) ExecuteQuery(c *gin.Context) {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
-	dqlQuery, err := h.converter.ConvertToDQL(&jsonQuery)
+
+	conv, ok := h.converterFor(c)
+	if !ok {
+		return
+	}
+	dqlQuery, err := conv.ConvertToDQL(&jsonQuery)
+	if err != nil {
+		respondConversionError(c, err)
+		return
+	}
+
+	dqlString := conv.GenerateDQLString(dqlQuery)
+	dqlVars := conv.GenerateDQLVariables(dqlQuery)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	response, err := h.dgraphClient.ExecuteDQLWithVars(ctx, dqlString, dqlVars)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to convert query",
-			"details": err.Error(),
+			"error":     "Query execution failed",
+			"details":   err.Error(),
+			"dql_query": dqlString,
+			"dql_vars":  dqlVars,
 		})
 		return
 	}
 
-	dqlString := h.converter.GenerateDQLString(dqlQuery)
+	stats := h.dgraphClient.GetExecutionStats(response)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"data":        response.Data,
+		"next_cursor": nextCursor(dqlQuery, response.Data),
+		"warnings":    dqlQuery.Warnings,
+		"query_info": gin.H{
+			"dql":        dqlString,
+			"dql_vars":   dqlVars,
+			"query_time": response.QueryTime,
+			"stats":      stats,
+		},
+	})
+
+}
+
+// CountQuery returns the number of records matching a query without fetching them
+func (h *QueryHandler) CountQuery(c *gin.Context) {
+	var jsonQuery models.JSONQuery
+	if err := c.ShouldBindJSON(&jsonQuery); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	conv, ok := h.converterFor(c)
+	if !ok {
+		return
+	}
+	dqlQuery, err := conv.ConvertToCountDQL(&jsonQuery)
+	if err != nil {
+		respondConversionError(c, err)
+		return
+	}
+
+	if h.dgraphClient == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Dgraph is not connected"})
+		return
+	}
+
+	dqlString := conv.GenerateDQLString(dqlQuery)
+	dqlVars := conv.GenerateDQLVariables(dqlQuery)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	response, err := h.dgraphClient.ExecuteDQL(ctx, dqlString)
+	response, err := h.dgraphClient.ExecuteDQLWithVars(ctx, dqlString, dqlVars)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":     "Query execution failed",
 			"details":   err.Error(),
 			"dql_query": dqlString,
+			"dql_vars":  dqlVars,
+		})
+		return
+	}
+
+	count, err := extractCount(response.Data, dqlQuery.MainQuery.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Unexpected count response",
+			"details":   err.Error(),
+			"dql_query": dqlString,
+			"dql_vars":  dqlVars,
 		})
 		return
 	}
 
 	stats := h.dgraphClient.GetExecutionStats(response)
+	stats.ResultCount = count
 
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data":    response.Data,
+		"success":  true,
+		"count":    count,
+		"warnings": dqlQuery.Warnings,
 		"query_info": gin.H{
 			"dql":        dqlString,
+			"dql_vars":   dqlVars,
 			"query_time": response.QueryTime,
 			"stats":      stats,
 		},
 	})
+}
+
+// ExplainQuery describes how a query compiles: the normalized filter tree, how
+// each filter resolved, the var blocks and root function and, when Dgraph is
+// connected, how many records the segment and each var block match
+func (h *QueryHandler) ExplainQuery(c *gin.Context) {
+	var jsonQuery models.JSONQuery
+	if err := c.ShouldBindJSON(&jsonQuery); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	conv, ok := h.converterFor(c)
+	if !ok {
+		return
+	}
+	explanation, err := conv.Explain(&jsonQuery)
+	if err != nil {
+		respondConversionError(c, err)
+		return
+	}
+
+	if h.dgraphClient != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if count, err := h.runCount(ctx, conv, explanation.CountQuery); err == nil {
+			explanation.Count = &count
+		}
+		for i := range explanation.VarBlocks {
+			block := &explanation.VarBlocks[i]
+			count, err := h.runCount(ctx, conv, block.CountQuery)
+			if err != nil {
+				block.CountError = err.Error()
+				continue
+			}
+			block.Cardinality = &count
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":          true,
+		"explanation":      explanation,
+		"dgraph_connected": h.dgraphClient != nil,
+	})
+}
 
+// runCount executes a count-only query and returns its count
+func (h *QueryHandler) runCount(ctx context.Context, conv *converter.Converter, dqlQuery *models.DQLQuery) (int, error) {
+	response, err := h.dgraphClient.ExecuteDQLWithVars(ctx, conv.GenerateDQLString(dqlQuery), conv.GenerateDQLVariables(dqlQuery))
+	if err != nil {
+		return 0, err
+	}
+	return extractCount(response.Data, dqlQuery.MainQuery.Name)
+}
+
+// nextCursor returns the cursor of the page following the returned rows, or ""
+// when the segment is exhausted or the query is sorted and cannot use cursors
+func nextCursor(dqlQuery *models.DQLQuery, data interface{}) string {
+	if dqlQuery.MainQuery.Ordering != "" {
+		return ""
+	}
+
+	dataMap, ok := data.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+
+	rows, ok := dataMap[dqlQuery.MainQuery.Name].([]interface{})
+	if !ok || len(rows) == 0 || len(rows) < dqlQuery.MainQuery.Limit {
+		return ""
+	}
+
+	last, ok := rows[len(rows)-1].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+
+	uid, ok := last["uid"].(string)
+	if !ok {
+		return ""
+	}
+
+	return converter.EncodeCursor(dqlQuery.MainQuery.Name, uid)
+}
+
+// extractCount reads count(uid) from the response of a count-only query,
+// shaped as {"<block>": [{"count": N}]}
+func extractCount(data interface{}, blockName string) (int, error) {
+	dataMap, ok := data.(map[string]interface{})
+	if !ok {
+		return 0, fmt.Errorf("response has no data")
+	}
+
+	rows, ok := dataMap[blockName].([]interface{})
+	if !ok || len(rows) == 0 {
+		return 0, fmt.Errorf("response has no %q block", blockName)
+	}
+
+	row, ok := rows[0].(map[string]interface{})
+	if !ok {
+		return 0, fmt.Errorf("unexpected %q block shape", blockName)
+	}
+
+	count, ok := row["count"].(float64)
+	if !ok {
+		return 0, fmt.Errorf("response has no count in %q block", blockName)
+	}
+
+	return int(count), nil
+}
+
+// respondConversionError writes validation problems as 422 Unprocessable Entity
+// and any other conversion failure as 500
+func respondConversionError(c *gin.Context, err error) {
+	var validationErr *converter.ValidationError
+	if errors.As(err, &validationErr) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":  "Invalid query",
+			"issues": validationErr.Issues,
+		})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error":   "Failed to convert query",
+		"details": err.Error(),
+	})
 }
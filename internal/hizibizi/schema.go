@@ -0,0 +1,9 @@
+// Package hizibizi holds the Dgraph schema the segmentation queries run against.
+package hizibizi
+
+import _ "embed"
+
+// Schema is the DQL schema of the platform graph, as applied to Dgraph
+//
+//go:embed schema.txt
+var Schema string
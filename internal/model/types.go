@@ -2,35 +2,121 @@ package models
 
 // JSONQuery represents the root structure of the incoming JSON query
 type JSONQuery struct {
-	CombineWith string  `json:"combine_with" binding:"required"`
-	Groups      []Group `json:"groups" binding:"required"`
-	Limit       int     `json:"limit,omitempty"`
-	Offset      int     `json:"offset,omitempty"`
+	CombineWith  string     `json:"combine_with" binding:"required"`
+	Groups       []Group    `json:"groups" binding:"required"`
+	TargetEntity string     `json:"target_entity,omitempty"` // entity type to segment, defaults to customers
+	Select       *Selection `json:"select,omitempty"`        // fields to return, defaults to DefaultFields
+	Sort         []SortKey  `json:"sort,omitempty"`
+	Limit        int        `json:"limit,omitempty"`
+	Offset       int        `json:"offset,omitempty"`
+	Cursor       string     `json:"cursor,omitempty"` // next_cursor of the previous page
+}
+
+// Selection describes the fields returned for an entity, by JSON field name,
+// and the related entities to return with it
+type Selection struct {
+	Fields    []string            `json:"fields,omitempty"`
+	Relations []RelationSelection `json:"relations,omitempty"`
+}
+
+// RelationSelection returns the records of a related entity, optionally
+// filtered, sorted and limited independently of the main query. Without a
+// limit it returns the default page size.
+type RelationSelection struct {
+	Entity    string              `json:"entity" binding:"required"`
+	Fields    []string            `json:"fields,omitempty"`
+	Relations []RelationSelection `json:"relations,omitempty"`
+	Filter    *Group              `json:"filter,omitempty"`
+	Sort      []SortKey           `json:"sort,omitempty"`
+	Limit     int                 `json:"limit,omitempty"`
+}
+
+// SortKey orders results by a JSON field name, or by an aggregate over a
+// relationship of the root entity such as the number of purchases
+type SortKey struct {
+	Field     string `json:"field,omitempty"`
+	Direction string `json:"direction,omitempty"` // "asc" (default) or "desc"
+
+	Aggregate    string `json:"aggregate,omitempty"`
+	Relationship string `json:"relationship,omitempty"`
+	Where        *Group `json:"where,omitempty"`
 }
 
 type Group struct {
 	CombineWith string   `json:"combine_with" binding:"required"`
 	Filters     []Filter `json:"filters,omitempty"`
 	Groups      []Group  `json:"groups,omitempty"`
+	// Scope names a related entity that every filter in the group must match
+	// on the same record, e.g. one subscription that is both active and Premium
+	Scope string `json:"scope,omitempty"`
+	// Negate inverts the combined condition. On a scoped group it keeps roots
+	// with no related record matching the group.
+	Negate bool `json:"negate,omitempty"`
+	// Macro replaces the group with the named FilterMacro, instantiated with
+	// Args. Negate still applies to the expanded group.
+	Macro string                 `json:"macro,omitempty"`
+	Args  map[string]interface{} `json:"args,omitempty"`
 }
 
 // Filter represents a single filter condition
 type Filter struct {
-	Field string      `json:"field" binding:"required"`
+	Field string      `json:"field,omitempty"`
 	Op    string      `json:"op" binding:"required"`
 	Value interface{} `json:"value" binding:"required"`
+
+	// Aggregate turns the filter into a comparison on count, sum, avg, min or
+	// max over the related records named by Relationship. Field names the
+	// aggregated field and is omitted for count. The HAS_NONE operator uses
+	// Relationship and Where without a field or value.
+	Aggregate    string `json:"aggregate,omitempty"`
+	Relationship string `json:"relationship,omitempty"`
+	Where        *Group `json:"where,omitempty"` // per-record conditions on the related records
+
+	// Macro replaces the filter with the group of the named FilterMacro,
+	// instantiated with Args
+	Macro string                 `json:"macro,omitempty"`
+	Args  map[string]interface{} `json:"args,omitempty"`
+}
+
+// FilterMacro is a named, reusable group that filters and groups reference
+// with {"macro": name}. Values in the group written as {"param": name} are
+// replaced by the reference's argument of that name.
+type FilterMacro struct {
+	Description string `json:"description,omitempty"`
+	// Params maps each parameter to its default value. A nil default makes
+	// the parameter required.
+	Params map[string]interface{} `json:"params,omitempty"`
+	Group  Group                  `json:"group"`
 }
 
 type DQLQuery struct {
 	Variables []VariableBlock `json:"variables,omitempty"`
 	MainQuery MainQuery       `json:"main_query"`
+	Params    []QueryParam    `json:"params,omitempty"`
+	Warnings  []QueryWarning  `json:"warnings,omitempty"`
+}
+
+// QueryWarning flags a group that converts but is unlikely to be what was
+// meant, such as one that can never match
+type QueryWarning struct {
+	Path    string `json:"path"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// QueryParam is a GraphQL-style query variable such as $v0: string
+type QueryParam struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
 }
 
 type VariableBlock struct {
-	Name   string `json:"name"`
-	Type   string `json:"type"`
-	Filter string `json:"filter"`
-	Fields string `json:"fields"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Filter  string `json:"filter"`
+	Fields  string `json:"fields"`
+	Cascade bool   `json:"cascade,omitempty"`
 }
 
 type MainQuery struct {
@@ -40,6 +126,8 @@ type MainQuery struct {
 	Filter     string `json:"filter"`
 	Fields     string `json:"fields"`
 	Pagination string `json:"pagination"`
+	Ordering   string `json:"ordering,omitempty"`
+	Limit      int    `json:"limit"`
 }
 
 type EntityQuery struct {
@@ -56,6 +144,25 @@ type FieldMapping struct {
 	EntityType     string `json:"entity_type"`
 	DataType       string `json:"data_type"`
 	IsRelationship bool   `json:"is_relationship"`
+	// Computed is set for virtual fields derived from the datetime predicate
+	// in DgraphField instead of being stored
+	Computed *ComputedField `json:"computed,omitempty"`
+}
+
+// ComputedField describes a virtual field counting whole time units between
+// now and a datetime predicate, such as age from a date of birth
+type ComputedField struct {
+	Unit      string `json:"unit"`      // "years" or "days"
+	Direction string `json:"direction"` // "since" counts up from the date, "until" counts down to it
+}
+
+// PredicateSchema describes a Dgraph predicate as declared in the schema
+type PredicateSchema struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	List    bool     `json:"list"`
+	Indexes []string `json:"indexes,omitempty"`
+	Reverse bool     `json:"reverse"`
 }
 
 type OperatorMapping struct {
@@ -69,3 +176,21 @@ type SchemaInfo struct {
 	Relationships map[string][]string       `json:"relationships"`
 	DefaultFields map[string][]string       `json:"default_fields"`
 }
+
+// ComplexityBudget bounds the size of a query a client may run
+type ComplexityBudget struct {
+	MaxLimit      int `json:"max_limit"`
+	MaxGroupDepth int `json:"max_group_depth"`
+	MaxFilters    int `json:"max_filters"`
+	MaxInValues   int `json:"max_in_values"`
+	MaxVarBlocks  int `json:"max_var_blocks"`
+	// MaxRelationDepth bounds how deeply selected relations nest
+	MaxRelationDepth int `json:"max_relation_depth"`
+}
+
+// APIClient is a client granted a larger complexity budget. It authenticates
+// with the API key held in the KeyEnv environment variable.
+type APIClient struct {
+	KeyEnv string           `json:"key_env"`
+	Budget ComplexityBudget `json:"budget"`
+}
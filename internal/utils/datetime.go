@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// relativeOffsetPattern matches one signed offset such as "-30d" or "+2M"
+var relativeOffsetPattern = regexp.MustCompile(`^([+-])(\d+)([smhdwMy])`)
+
+// relativeAnchors are the named points in time a relative expression can start from
+var relativeAnchors = map[string]func(now time.Time) time.Time{
+	"now": func(now time.Time) time.Time { return now },
+	"today": func(now time.Time) time.Time {
+		return startOfDay(now)
+	},
+	"start_of_day": func(now time.Time) time.Time {
+		return startOfDay(now)
+	},
+	"start_of_week": func(now time.Time) time.Time {
+		// Weeks start on Monday
+		offset := (int(now.Weekday()) + 6) % 7
+		return startOfDay(now).AddDate(0, 0, -offset)
+	},
+	"start_of_month": func(now time.Time) time.Time {
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	},
+	"start_of_year": func(now time.Time) time.Time {
+		return time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, now.Location())
+	},
+}
+
+// ResolveRelativeDate resolves a relative datetime expression against now.
+// An expression is an optional anchor followed by signed offsets, e.g.
+// "now-30d", "start_of_month", "start_of_month-1M" or "-7d" (relative to now).
+// Units are s, m, h, d, w, M (months) and y.
+func ResolveRelativeDate(expr string, now time.Time) (time.Time, error) {
+	rest := strings.TrimSpace(expr)
+	if rest == "" {
+		return time.Time{}, fmt.Errorf("empty relative date expression")
+	}
+
+	result := now
+	anchorEnd := strings.IndexAny(rest, "+-")
+	if anchorEnd != 0 {
+		name := rest
+		if anchorEnd > 0 {
+			name = rest[:anchorEnd]
+		}
+		anchor, ok := relativeAnchors[name]
+		if !ok {
+			return time.Time{}, fmt.Errorf("unknown relative date anchor %q in %q", name, expr)
+		}
+		result = anchor(now)
+		rest = rest[len(name):]
+	}
+
+	for rest != "" {
+		match := relativeOffsetPattern.FindStringSubmatch(rest)
+		if match == nil {
+			return time.Time{}, fmt.Errorf("invalid relative date offset %q in %q", rest, expr)
+		}
+
+		amount, err := strconv.Atoi(match[2])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid relative date amount in %q: %w", expr, err)
+		}
+		if match[1] == "-" {
+			amount = -amount
+		}
+
+		switch match[3] {
+		case "s":
+			result = result.Add(time.Duration(amount) * time.Second)
+		case "m":
+			result = result.Add(time.Duration(amount) * time.Minute)
+		case "h":
+			result = result.Add(time.Duration(amount) * time.Hour)
+		case "d":
+			result = result.AddDate(0, 0, amount)
+		case "w":
+			result = result.AddDate(0, 0, amount*7)
+		case "M":
+			result = result.AddDate(0, amount, 0)
+		case "y":
+			result = result.AddDate(amount, 0, 0)
+		}
+
+		rest = rest[len(match[0]):]
+	}
+
+	return result, nil
+}
+
+// IsRelativeDate reports whether a string looks like a relative date expression
+// rather than an absolute datetime
+func IsRelativeDate(expr string) bool {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return false
+	}
+	if expr[0] == '+' || expr[0] == '-' {
+		return true
+	}
+	name := expr
+	if end := strings.IndexAny(expr, "+-"); end > 0 {
+		name = expr[:end]
+	}
+	_, ok := relativeAnchors[name]
+	return ok
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,377 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version as described at https://semver.org
+type Version struct {
+	Major      int64
+	Minor      int64
+	Patch      int64
+	Prerelease []string // dot-separated identifiers after "-", e.g. ["beta", "1"]
+	Build      string   // metadata after "+", ignored when comparing
+}
+
+// ParseVersion parses a semantic version. A leading "v" is accepted and a
+// missing minor or patch part is read as zero, so "v5.2" is 5.2.0.
+func ParseVersion(version string) (Version, error) {
+	v, present, err := parsePartialVersion(version)
+	if err != nil {
+		return Version{}, err
+	}
+
+	core, _, _ := strings.Cut(version, "+")
+	core, _, _ = strings.Cut(core, "-")
+	if !present[0] || strings.ContainsAny(core, "xX*") {
+		return Version{}, fmt.Errorf("invalid version %q: wildcards are only allowed in ranges", version)
+	}
+	return v, nil
+}
+
+// parsePartialVersion parses a version whose minor and patch parts may be
+// missing or given as x, X or * wildcards. present reports which of the major,
+// minor and patch parts were given as numbers.
+func parsePartialVersion(version string) (Version, [3]bool, error) {
+	var v Version
+	var present [3]bool
+
+	text := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(version), "v"), "V")
+	if text == "" {
+		return v, present, fmt.Errorf("empty version")
+	}
+
+	if core, build, found := strings.Cut(text, "+"); found {
+		if !validIdentifiers(build) {
+			return v, present, fmt.Errorf("invalid build metadata in version %q", version)
+		}
+		text, v.Build = core, build
+	}
+	if core, prerelease, found := strings.Cut(text, "-"); found {
+		if !validIdentifiers(prerelease) {
+			return v, present, fmt.Errorf("invalid pre-release in version %q", version)
+		}
+		text, v.Prerelease = core, strings.Split(prerelease, ".")
+	}
+
+	parts := strings.Split(text, ".")
+	if len(parts) > 3 {
+		return v, present, fmt.Errorf("invalid version %q: expected at most major.minor.patch", version)
+	}
+
+	numbers := [3]*int64{&v.Major, &v.Minor, &v.Patch}
+	wildcard := false
+	for i, part := range parts {
+		if part == "x" || part == "X" || part == "*" {
+			wildcard = true
+			continue
+		}
+		if wildcard {
+			return v, present, fmt.Errorf("invalid version %q: number after wildcard", version)
+		}
+		n, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || n < 0 || (len(part) > 1 && part[0] == '0') {
+			return v, present, fmt.Errorf("invalid version part %q in %q", part, version)
+		}
+		*numbers[i] = n
+		present[i] = true
+	}
+
+	if len(v.Prerelease) > 0 && !present[2] {
+		return v, present, fmt.Errorf("invalid version %q: a pre-release requires major.minor.patch", version)
+	}
+
+	return v, present, nil
+}
+
+// validIdentifiers reports whether a pre-release or build string consists of
+// non-empty dot-separated alphanumeric identifiers
+func validIdentifiers(s string) bool {
+	for _, identifier := range strings.Split(s, ".") {
+		if identifier == "" {
+			return false
+		}
+		for _, r := range identifier {
+			if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Compare returns -1, 0 or 1 when v precedes, equals or follows other. A
+// pre-release precedes its release, and pre-release identifiers are compared
+// numerically when both are numbers and as text otherwise, so
+// 1.0.0-alpha < 1.0.0-alpha.1 < 1.0.0-beta < 1.0.0-beta.2 < 1.0.0-beta.11 < 1.0.0.
+func (v Version) Compare(other Version) int {
+	for _, pair := range [][2]int64{{v.Major, other.Major}, {v.Minor, other.Minor}, {v.Patch, other.Patch}} {
+		if pair[0] != pair[1] {
+			if pair[0] < pair[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	switch {
+	case len(v.Prerelease) == 0 && len(other.Prerelease) == 0:
+		return 0
+	case len(v.Prerelease) == 0:
+		return 1
+	case len(other.Prerelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(v.Prerelease) && i < len(other.Prerelease); i++ {
+		if cmp := compareIdentifiers(v.Prerelease[i], other.Prerelease[i]); cmp != 0 {
+			return cmp
+		}
+	}
+
+	switch {
+	case len(v.Prerelease) < len(other.Prerelease):
+		return -1
+	case len(v.Prerelease) > len(other.Prerelease):
+		return 1
+	}
+	return 0
+}
+
+// compareIdentifiers orders two pre-release identifiers. Numeric identifiers
+// precede alphanumeric ones.
+func compareIdentifiers(a, b string) int {
+	aNum, aErr := strconv.ParseUint(a, 10, 64)
+	bNum, bErr := strconv.ParseUint(b, 10, 64)
+
+	switch {
+	case aErr == nil && bErr == nil:
+		if aNum != bNum {
+			if aNum < bNum {
+				return -1
+			}
+			return 1
+		}
+		return 0
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// String renders the version without its build metadata
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.Prerelease) > 0 {
+		s += "-" + strings.Join(v.Prerelease, ".")
+	}
+	return s
+}
+
+// VersionComparator is a single bound of a range, such as ">=5.2.0"
+type VersionComparator struct {
+	Op      string // "=", ">", ">=", "<" or "<="
+	Version Version
+}
+
+// NamesPrerelease reports whether the comparator bounds a pre-release. The
+// "<X.Y.Z-0" upper bounds that caret, tilde and partial versions desugar to
+// only leave out the pre-releases of X.Y.Z and do not count.
+func (c VersionComparator) NamesPrerelease() bool {
+	return len(c.Version.Prerelease) > 0 && !(c.Op == "<" && isZeroPrerelease(c.Version))
+}
+
+// VersionRange is an npm-style range: a union of comparator sets, each of
+// which matches when all of its comparators do. An empty set matches any version.
+type VersionRange [][]VersionComparator
+
+// ParseVersionRange parses an npm-style range such as "^5.2", "~1.4.0",
+// ">=5.0 <6", "1.2 - 2.3", "5.x" or "^4.0 || ^5.0". Partial versions and caret,
+// tilde and x-ranges are desugared into plain comparators the way npm does, so
+// "^5.2" becomes ">=5.2.0 <6.0.0-0".
+func ParseVersionRange(expr string) (VersionRange, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, fmt.Errorf("empty version range")
+	}
+
+	var versionRange VersionRange
+	for _, set := range strings.Split(expr, "||") {
+		comparators, err := parseComparatorSet(strings.TrimSpace(set))
+		if err != nil {
+			return nil, fmt.Errorf("invalid version range %q: %w", expr, err)
+		}
+		versionRange = append(versionRange, comparators)
+	}
+	return versionRange, nil
+}
+
+// parseComparatorSet parses space-separated comparators or a hyphen range
+func parseComparatorSet(set string) ([]VersionComparator, error) {
+	fields := strings.Fields(set)
+
+	if len(fields) == 3 && fields[1] == "-" {
+		return parseHyphenRange(fields[0], fields[2])
+	}
+
+	var comparators []VersionComparator
+	for i := 0; i < len(fields); i++ {
+		token := fields[i]
+		// Allow a space between an operator and its version, as in ">= 5.0"
+		if strings.TrimLeft(token, "<>=~^") == "" && i+1 < len(fields) {
+			i++
+			token += fields[i]
+		}
+
+		parsed, err := parseComparator(token)
+		if err != nil {
+			return nil, err
+		}
+		comparators = append(comparators, parsed...)
+	}
+	return comparators, nil
+}
+
+// parseHyphenRange desugars "A - B" into ">=A <=B". A partial upper bound
+// includes every version it covers, so "1.2 - 2.3" ends before 2.4.0.
+func parseHyphenRange(low, high string) ([]VersionComparator, error) {
+	lower, lowerPresent, err := parsePartialVersion(low)
+	if err != nil {
+		return nil, err
+	}
+	upper, upperPresent, err := parsePartialVersion(high)
+	if err != nil {
+		return nil, err
+	}
+
+	var comparators []VersionComparator
+	if lowerPresent[0] {
+		comparators = append(comparators, VersionComparator{Op: ">=", Version: lower})
+	}
+	switch {
+	case upperPresent[2]:
+		comparators = append(comparators, VersionComparator{Op: "<=", Version: upper})
+	case upperPresent[1]:
+		comparators = append(comparators, VersionComparator{Op: "<", Version: nextMinor(upper)})
+	case upperPresent[0]:
+		comparators = append(comparators, VersionComparator{Op: "<", Version: nextMajor(upper)})
+	}
+	return comparators, nil
+}
+
+// parseComparator desugars a single range token into plain comparators
+func parseComparator(token string) ([]VersionComparator, error) {
+	op := ""
+	for _, prefix := range []string{">=", "<=", "~>", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(token, prefix) {
+			op = prefix
+			break
+		}
+	}
+
+	v, present, err := parsePartialVersion(strings.TrimPrefix(token, op))
+	if err != nil {
+		return nil, err
+	}
+
+	// Any version: "*", "x" or an operator followed by a wildcard
+	if !present[0] {
+		if op == "<" || op == ">" {
+			return nil, fmt.Errorf("%q matches no version", token)
+		}
+		return []VersionComparator{}, nil
+	}
+
+	full := present[2]
+	switch op {
+	case "^":
+		upper := nextMajor(v)
+		switch {
+		case v.Major == 0 && present[1] && v.Minor == 0 && full:
+			upper = nextPatch(v)
+		case v.Major == 0 && present[1]:
+			upper = nextMinor(v)
+		}
+		return between(v, upper), nil
+
+	case "~", "~>":
+		if present[1] {
+			return between(v, nextMinor(v)), nil
+		}
+		return between(v, nextMajor(v)), nil
+
+	case ">":
+		switch {
+		case full:
+			return []VersionComparator{{Op: ">", Version: v}}, nil
+		case present[1]:
+			return []VersionComparator{{Op: ">=", Version: nextMinor(v).release()}}, nil
+		default:
+			return []VersionComparator{{Op: ">=", Version: nextMajor(v).release()}}, nil
+		}
+
+	case ">=":
+		return []VersionComparator{{Op: ">=", Version: v}}, nil
+
+	case "<":
+		if full {
+			return []VersionComparator{{Op: "<", Version: v}}, nil
+		}
+		return []VersionComparator{{Op: "<", Version: v.withZeroPrerelease()}}, nil
+
+	case "<=":
+		switch {
+		case full:
+			return []VersionComparator{{Op: "<=", Version: v}}, nil
+		case present[1]:
+			return []VersionComparator{{Op: "<", Version: nextMinor(v)}}, nil
+		default:
+			return []VersionComparator{{Op: "<", Version: nextMajor(v)}}, nil
+		}
+
+	default:
+		switch {
+		case full:
+			return []VersionComparator{{Op: "=", Version: v}}, nil
+		case present[1]:
+			return between(v, nextMinor(v)), nil
+		default:
+			return between(v, nextMajor(v)), nil
+		}
+	}
+}
+
+// between returns the comparators for lower <= v < upper
+func between(lower, upper Version) []VersionComparator {
+	return []VersionComparator{{Op: ">=", Version: lower}, {Op: "<", Version: upper}}
+}
+
+// nextMajor, nextMinor and nextPatch return the lowest pre-release of the
+// following version, the exclusive upper bound npm uses for caret and tilde
+func nextMajor(v Version) Version {
+	return Version{Major: v.Major + 1, Prerelease: []string{"0"}}
+}
+
+func nextMinor(v Version) Version {
+	return Version{Major: v.Major, Minor: v.Minor + 1, Prerelease: []string{"0"}}
+}
+
+func nextPatch(v Version) Version {
+	return Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1, Prerelease: []string{"0"}}
+}
+
+func (v Version) withZeroPrerelease() Version {
+	return Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch, Prerelease: []string{"0"}}
+}
+
+func (v Version) release() Version {
+	return Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch}
+}
+
+// isZeroPrerelease reports whether v is the lowest pre-release X.Y.Z-0
+func isZeroPrerelease(v Version) bool {
+	return len(v.Prerelease) == 1 && v.Prerelease[0] == "0"
+}
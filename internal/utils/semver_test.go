@@ -0,0 +1,233 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVersionComparePrereleaseOrdering(t *testing.T) {
+	// Ascending precedence, from the examples of the semver specification
+	ordered := []string{
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.1-0",
+		"1.0.1",
+		"1.10.0",
+		"2.0.0",
+	}
+
+	for i, a := range ordered {
+		for j, b := range ordered {
+			want := 0
+			switch {
+			case i < j:
+				want = -1
+			case i > j:
+				want = 1
+			}
+			if got := mustParse(t, a).Compare(mustParse(t, b)); got != want {
+				t.Errorf("Compare(%s, %s) = %d, want %d", a, b, got, want)
+			}
+		}
+	}
+}
+
+func TestVersionBuildMetadata(t *testing.T) {
+	tests := []struct {
+		version string
+		build   string
+		equal   string
+	}{
+		{"1.0.0+20130313144700", "20130313144700", "1.0.0"},
+		{"1.0.0-beta+exp.sha.5114f85", "exp.sha.5114f85", "1.0.0-beta"},
+		{"v2.1+build-7", "build-7", "2.1.0"},
+	}
+
+	for _, tt := range tests {
+		v := mustParse(t, tt.version)
+		if v.Build != tt.build {
+			t.Errorf("ParseVersion(%q).Build = %q, want %q", tt.version, v.Build, tt.build)
+		}
+		if got := v.Compare(mustParse(t, tt.equal)); got != 0 {
+			t.Errorf("Compare(%s, %s) = %d, want 0: build metadata is ignored", tt.version, tt.equal, got)
+		}
+		if v.String() != tt.equal {
+			t.Errorf("String() = %q, want %q", v.String(), tt.equal)
+		}
+	}
+}
+
+func TestParseVersionErrors(t *testing.T) {
+	for _, version := range []string{
+		"",
+		"1.2.3.4",
+		"01.2.3",
+		"1.x",
+		"5.2.X",
+		"*",
+		"1.2-beta",
+		"1.0.0-",
+		"1.0.0-beta..1",
+		"1.0.0+",
+		"1.0.0+build!",
+		"a.b.c",
+	} {
+		if v, err := ParseVersion(version); err == nil {
+			t.Errorf("ParseVersion(%q) = %s, want an error", version, v)
+		}
+	}
+}
+
+func TestConvertVersionToNumeric(t *testing.T) {
+	tests := []struct {
+		version string
+		want    int64
+	}{
+		{"5.0.0", 50000000000001},
+		{"10.2.1", 100000020000011},
+		{"5.2", 50000020000001},
+		{"5.2.0+build.1", 50000020000001},
+		// Every pre-release of a version shares the value just below it
+		{"5.2.0-beta.1", 50000020000000},
+		{"5.2.0-beta.2", 50000020000000},
+	}
+
+	for _, tt := range tests {
+		got, err := ConvertVersionToNumeric(tt.version)
+		if err != nil || got != tt.want {
+			t.Errorf("ConvertVersionToNumeric(%q) = %d, %v, want %d", tt.version, got, err, tt.want)
+		}
+	}
+
+	if _, err := ConvertVersionToNumeric("1.1000000.0"); err == nil {
+		t.Error("ConvertVersionToNumeric accepted a part too large for the encoding")
+	}
+}
+
+func TestParseVersionRange(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		// Caret allows changes that do not modify the leftmost non-zero part
+		{"^5.2", ">=5.2.0 <6.0.0-0"},
+		{"^5.2.3", ">=5.2.3 <6.0.0-0"},
+		{"^0.2.3", ">=0.2.3 <0.3.0-0"},
+		{"^0.0.3", ">=0.0.3 <0.0.4-0"},
+		{"^0.0", ">=0.0.0 <0.1.0-0"},
+		{"^0.x", ">=0.0.0 <1.0.0-0"},
+		{"^0", ">=0.0.0 <1.0.0-0"},
+		{"^1.2.3-beta.2", ">=1.2.3-beta.2 <2.0.0-0"},
+
+		// Tilde allows patch changes, or minor ones when only a major is given
+		{"~1.4.0", ">=1.4.0 <1.5.0-0"},
+		{"~1.4", ">=1.4.0 <1.5.0-0"},
+		{"~1", ">=1.0.0 <2.0.0-0"},
+		{"~>1.4", ">=1.4.0 <1.5.0-0"},
+		{"~0.2.3", ">=0.2.3 <0.3.0-0"},
+
+		// Hyphen ranges include every version a partial upper bound covers
+		{"1.2.3 - 2.3.4", ">=1.2.3 <=2.3.4"},
+		{"1.2 - 2.3", ">=1.2.0 <2.4.0-0"},
+		{"1.2.3 - 2", ">=1.2.3 <3.0.0-0"},
+
+		// Comparators, partial versions and x-ranges
+		{">=5.0 <6", ">=5.0.0 <6.0.0-0"},
+		{">= 5.0", ">=5.0.0"},
+		{">1.2", ">=1.3.0"},
+		{"<=1.2", "<1.3.0-0"},
+		{"5.x", ">=5.0.0 <6.0.0-0"},
+		{"5.2.*", ">=5.2.0 <5.3.0-0"},
+		{"1.2.3", "=1.2.3"},
+		{"=v1.2.3+build.5", "=1.2.3"},
+		{"*", "*"},
+
+		// Alternatives
+		{"^4.0 || ^5.0", ">=4.0.0 <5.0.0-0 || >=5.0.0 <6.0.0-0"},
+		{"1.2.7 || >=1.2.9 <2.0.0", "=1.2.7 || >=1.2.9 <2.0.0"},
+		{"<1 || *", "<1.0.0-0 || *"},
+	}
+
+	for _, tt := range tests {
+		versionRange, err := ParseVersionRange(tt.expr)
+		if err != nil {
+			t.Errorf("ParseVersionRange(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := formatRange(versionRange); got != tt.want {
+			t.Errorf("ParseVersionRange(%q) = %q, want %q", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseVersionRangeErrors(t *testing.T) {
+	for _, expr := range []string{"", "  ", ">*", "<x", "^a", "5.2.x.1", ">=1.x.3"} {
+		if _, err := ParseVersionRange(expr); err == nil {
+			t.Errorf("ParseVersionRange(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestVersionComparatorNamesPrerelease(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"^5.2", false},
+		{">=5.0 <6", false},
+		{"<6.0.0-0", false},
+		{"^5.2.0-beta.1", true},
+		{">=5.0.0-0", true},
+		{"<6.0.0-rc.1", true},
+		{"1.0.0 - 2.0.0-beta", true},
+	}
+
+	for _, tt := range tests {
+		versionRange, err := ParseVersionRange(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseVersionRange(%q): %v", tt.expr, err)
+		}
+		got := false
+		for _, set := range versionRange {
+			for _, comparator := range set {
+				got = got || comparator.NamesPrerelease()
+			}
+		}
+		if got != tt.want {
+			t.Errorf("%q names a pre-release = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func mustParse(t *testing.T, version string) Version {
+	t.Helper()
+	v, err := ParseVersion(version)
+	if err != nil {
+		t.Fatalf("ParseVersion(%q): %v", version, err)
+	}
+	return v
+}
+
+// formatRange renders a range as space-separated comparators, with "*" for
+// a set matching any version
+func formatRange(versionRange VersionRange) string {
+	sets := make([]string, 0, len(versionRange))
+	for _, set := range versionRange {
+		if len(set) == 0 {
+			sets = append(sets, "*")
+			continue
+		}
+		comparators := make([]string, 0, len(set))
+		for _, comparator := range set {
+			comparators = append(comparators, comparator.Op+comparator.Version.String())
+		}
+		sets = append(sets, strings.Join(comparators, " "))
+	}
+	return strings.Join(sets, " || ")
+}
@@ -2,7 +2,6 @@ package utils
 
 import (
 	"fmt"
-	"strconv"
 	"strings"
 )
 
@@ -10,7 +9,7 @@ import (
 type VersionComparisonMode string
 
 const (
-	VersionModeNumeric     VersionComparisonMode = "numeric"     // Convert to numeric (e.g., 5.0.0 -> 5000000)
+	VersionModeNumeric     VersionComparisonMode = "numeric"     // Convert to numeric (e.g., 5.0.0 -> 50000000000001)
 	VersionModeLexographic VersionComparisonMode = "lexographic" // Use string comparison (default DQL)
 	VersionModeSemantic    VersionComparisonMode = "semantic"    // Parse semantic versions
 )
@@ -21,39 +20,37 @@ type VersionField struct {
 	Mode  VersionComparisonMode `json:"mode"`
 }
 
-// ConvertVersionToNumeric converts a semantic version string to a comparable number
-// Example: "5.0.0" -> 5000000, "10.2.1" -> 10002001
+// maxVersionPart bounds each version part so that numeric versions fit in an int64
+const maxVersionPart = 999999
+
+// ConvertVersionToNumeric converts a semantic version string to a comparable
+// number: six digits each for major, minor and patch followed by a digit that
+// is 0 for pre-releases and 1 for releases.
+// Example: "5.0.0" -> 50000000000001, "10.2.1" -> 100000020000011,
+// "5.2.0-beta.1" -> 50000020000000
+// Pre-releases of the same version share a value, so the number orders them
+// before their release but not among each other; use Version.Compare for that.
+// Release operands therefore compare exactly against stored pre-releases, but
+// pre-release operands cannot, and version filters reject them.
 func ConvertVersionToNumeric(version string) (int64, error) {
-	// Remove any non-numeric prefixes (like 'v')
-	version = strings.TrimPrefix(version, "v")
-
-	parts := strings.Split(version, ".")
-	if len(parts) < 1 || len(parts) > 4 {
-		return 0, fmt.Errorf("invalid version format: %s", version)
+	v, err := ParseVersion(version)
+	if err != nil {
+		return 0, err
 	}
+	return v.Numeric()
+}
 
-	// Pad with zeros if needed
-	for len(parts) < 3 {
-		parts = append(parts, "0")
+// Numeric returns the number ConvertVersionToNumeric stores for the version
+func (v Version) Numeric() (int64, error) {
+	if v.Major > maxVersionPart/10 || v.Minor > maxVersionPart || v.Patch > maxVersionPart {
+		return 0, fmt.Errorf("version %s has a part too large for a numeric version", v)
 	}
 
-	var result int64
-	multipliers := []int64{1000000, 1000, 1}
-
-	for i, part := range parts[:3] {
-		num, err := strconv.ParseInt(part, 10, 64)
-		if err != nil {
-			return 0, fmt.Errorf("invalid version part '%s' in %s", part, version)
-		}
-
-		if num > 999 {
-			return 0, fmt.Errorf("version part %d too large in %s", num, version)
-		}
-
-		result += num * multipliers[i]
+	release := int64(1)
+	if len(v.Prerelease) > 0 {
+		release = 0
 	}
-
-	return result, nil
+	return ((v.Major*1000000+v.Minor)*1000000+v.Patch)*10 + release, nil
 }
 
 // IsVersionField checks if a field should be treated as a version field